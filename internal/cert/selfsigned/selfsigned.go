@@ -10,84 +10,92 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"maps"
 	"math/big"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
+
+	"github.com/localcompose/locom/internal/compose"
+	"github.com/localcompose/locom/internal/config"
+	"github.com/localcompose/locom/internal/files"
+	"github.com/localcompose/locom/internal/stage"
 )
 
-// Public API
-//   Setup(): generates a local self-signed CA and a server cert (with SANs),
-//            writes Traefik TLS config pointing to the fullchain.
+// Public API (all paths are resolved against the stage root)
+//   Setup(): generates a local self-signed CA and a server cert (with SANs for
+//            the stage's dns.suffix and hostnames),
+//            writes the TLS config of the proxy engine pointing to the fullchain.
 //   Trust(): installs the CA into the OS trust store (curl + Chrome/Chromium on Linux,
 //            System keychain on macOS, User Root on Windows). Firefox/NSS not handled yet.
 //   Untrust(): removes the CA from the OS trust store.
 //   Cleanup(): removes generated files (does not touch OS trust stores).
 
 const (
-	defaultCertsDir  = "./proxy/certs"
-	defaultConfigDir = "./proxy/config"
-
 	caCertName     = "selfsigned.ca.crt"
 	caKeyName      = "selfsigned.ca.key"
 	serverCertName = "selfsigned.server.crt"
-	serverKeyName  = "selfsigned.server.key"
-	fullchainName  = "selfsigned.server.fullchain.crt" // server + (optionally) intermediates/root
-	traefikTLSFile = "selfsigned.yml"
-
-	// Identity — adjust to your domain set as needed
-	wildcardCN = "*.locom.self"
+	serverKeyName  = compose.KeyFile
+	fullchainName  = compose.FullchainFile // server + (optionally) intermediates/root
 )
 
-var defaultSANs = []string{
-	"proxy.locom.self",
-	"*.locom.self",
+// serverNames returns the certificate's common name, a wildcard for the stage
+// suffix, and its SANs: the wildcard plus every stage hostname, as names with
+// more than one label below the suffix are not covered by the wildcard.
+func serverNames(cfg *config.Config) (string, []string) {
+	wildcard := "*" + cfg.Stage.Network.DNS.Suffix
+	return wildcard, append([]string{wildcard}, cfg.Hostnames()...)
 }
 
-// Setup generates a CA and a server certificate (signed by that CA),
-// writes PEM files with sane permissions, and creates a Traefik TLS snippet
-// that references the fullchain + server key.
-func Setup() error {
-	if err := os.MkdirAll(defaultCertsDir, 0o755); err != nil {
-		return err
-	}
-	if err := os.MkdirAll(defaultConfigDir, 0o755); err != nil {
-		return err
+// requireHTTPS refuses to issue certificates for a proxy that serves plain http only.
+func requireHTTPS(cfg *config.Config) error {
+	if mode := cfg.Stage.Network.Proxy.TLS; !mode.HTTPS() {
+		return fmt.Errorf("stage.network.proxy.tls is %q: the proxy serves no https, so no certificate is needed", mode)
 	}
+	return nil
+}
 
-	caCertPath := filepath.Join(defaultCertsDir, caCertName)
-	caKeyPath := filepath.Join(defaultCertsDir, caKeyName)
-	serverCertPath := filepath.Join(defaultCertsDir, serverCertName)
-	serverKeyPath := filepath.Join(defaultCertsDir, serverKeyName)
-	fullchainPath := filepath.Join(defaultCertsDir, fullchainName)
-	traefikPath := filepath.Join(defaultConfigDir, traefikTLSFile)
+// certsDir holds the generated PEM files; it is mounted as /certs in the proxy container.
+func certsDir(root string) string {
+	return filepath.Join(stage.ProxyDir(root), "certs")
+}
 
-	// 1) Generate CA
-	caPriv, err := rsa.GenerateKey(rand.Reader, 4096)
+// Setup generates a CA, or reuses the existing one so it stays trusted, and
+// a server certificate (signed by that CA),
+// writes PEM files with sane permissions, and the TLS configuration of the
+// proxy engine that references the fullchain + server key. Files are written
+// through w.
+func Setup(w files.Writer, root string, profiles []string) error {
+	cfg, err := config.Load(stage.ConfigPath(root), profiles...)
 	if err != nil {
-		return fmt.Errorf("generate CA key: %w", err)
+		return fmt.Errorf("loading config: %w", err)
 	}
-	caTpl := &x509.Certificate{
-		SerialNumber:          big.NewInt(1),
-		Subject:               pkix.Name{Organization: []string{"Local Dev CA"}, CommonName: "Local Dev Root CA"},
-		NotBefore:             time.Now().Add(-time.Hour),
-		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
-		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
-		IsCA:                  true,
-		BasicConstraintsValid: true,
-		SubjectKeyId:          mustSubjectKeyID(&caPriv.PublicKey),
+	if err := requireHTTPS(cfg); err != nil {
+		return err
 	}
-	caDER, err := x509.CreateCertificate(rand.Reader, caTpl, caTpl, &caPriv.PublicKey, caPriv)
+	commonName, sans := serverNames(cfg)
+
+	engine, err := compose.EngineFor(cfg)
 	if err != nil {
-		return fmt.Errorf("create CA cert: %w", err)
-	}
-	if err := writePEM(caCertPath, "CERTIFICATE", caDER, 0o644); err != nil {
 		return err
 	}
-	if err := writePEM(caKeyPath, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(caPriv), 0o600); err != nil {
-		return err
+	certsDir := certsDir(root)
+
+	caCertPath := filepath.Join(certsDir, caCertName)
+	caKeyPath := filepath.Join(certsDir, caKeyName)
+	serverCertPath := filepath.Join(certsDir, serverCertName)
+	serverKeyPath := filepath.Join(certsDir, serverKeyName)
+	fullchainPath := filepath.Join(certsDir, fullchainName)
+
+	// 1) Reuse the CA so that it stays trusted, or generate one
+	caCert, caPriv, err := loadCA(caCertPath, caKeyPath)
+	if err != nil {
+		if caCert, caPriv, err = generateCA(w, caCertPath, caKeyPath); err != nil {
+			return err
+		}
 	}
 
 	// 2) Generate server cert signed by CA with SANs
@@ -95,54 +103,146 @@ func Setup() error {
 	if err != nil {
 		return fmt.Errorf("generate server key: %w", err)
 	}
+	// a fresh serial per certificate: browsers reject a reused issuer and serial
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Errorf("generate serial number: %w", err)
+	}
 	srvTpl := &x509.Certificate{
-		SerialNumber: big.NewInt(2),
-		Subject:      pkix.Name{CommonName: wildcardCN},
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
 		NotBefore:    time.Now().Add(-time.Hour),
 		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
 		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
 		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		DNSNames:     append([]string{}, defaultSANs...),
+		DNSNames:     sans,
 	}
-	srvDER, err := x509.CreateCertificate(rand.Reader, srvTpl, caTpl, &srvPriv.PublicKey, caPriv)
+	srvDER, err := x509.CreateCertificate(rand.Reader, srvTpl, caCert, &srvPriv.PublicKey, caPriv)
 	if err != nil {
 		return fmt.Errorf("create server cert: %w", err)
 	}
-	if err := writePEM(serverCertPath, "CERTIFICATE", srvDER, 0o644); err != nil {
+	if err := writePEM(w, serverCertPath, "CERTIFICATE", srvDER, 0o644); err != nil {
 		return err
 	}
-	if err := writePEM(serverKeyPath, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(srvPriv), 0o600); err != nil {
+	if err := writePEM(w, serverKeyPath, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(srvPriv), 0o600); err != nil {
 		return err
 	}
 
 	// 3) Fullchain (server + CA). Traefik is fine with a bundle as certFile.
-	if err := concatFiles(fullchainPath, serverCertPath, caCertPath); err != nil {
+	fullchain := append(pemBytes("CERTIFICATE", srvDER), pemBytes("CERTIFICATE", caCert.Raw)...)
+	if err := w.WriteFile(fullchainPath, fullchain, 0o644); err != nil {
 		return err
 	}
 
-	// 4) Traefik dynamic TLS config snippet (paths inside the container mount)
-	// Adjust mount so that host ./proxy/certs is mapped to /certs in the traefik container
-	traefikYAML := fmt.Sprintf(`tls:
-  certificates:
-    - certFile: "/certs/%s"
-      keyFile: "/certs/%s"
-`, filepath.Base(fullchainPath), filepath.Base(serverKeyPath))
-	if err := os.WriteFile(traefikPath, []byte(traefikYAML), 0o644); err != nil {
-		return fmt.Errorf("write traefik TLS file: %w", err)
+	// 4) TLS config of the proxy engine (paths inside the container mount)
+	tlsFiles, err := engine.TLSFiles(cfg)
+	if err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(tlsFiles)) {
+		if err := w.WriteFile(filepath.Join(stage.ProxyDir(root), name), tlsFiles[name], 0o644); err != nil {
+			return fmt.Errorf("write TLS file: %w", err)
+		}
 	}
 
 	return nil
 }
 
+// Uncovered lists the hostnames of the stage at root that the server
+// certificate does not cover, e.g. apps added after it was issued. It returns
+// os.ErrNotExist when no certificate was generated yet.
+func Uncovered(root string, profiles []string) ([]string, error) {
+	cfg, err := config.Load(stage.ConfigPath(root), profiles...)
+	if err != nil {
+		return nil, fmt.Errorf("loading config: %w", err)
+	}
+	cert, err := readCert(filepath.Join(certsDir(root), serverCertName))
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, name := range cfg.Hostnames() {
+		if cert.VerifyHostname(name) != nil {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+func generateCA(w files.Writer, certPath, keyPath string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	caPriv, err := rsa.GenerateKey(rand.Reader, 4096)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate CA key: %w", err)
+	}
+	caTpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"Local Dev CA"}, CommonName: "Local Dev Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		SubjectKeyId:          mustSubjectKeyID(&caPriv.PublicKey),
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTpl, caTpl, &caPriv.PublicKey, caPriv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create CA cert: %w", err)
+	}
+	if err := writePEM(w, certPath, "CERTIFICATE", caDER, 0o644); err != nil {
+		return nil, nil, err
+	}
+	if err := writePEM(w, keyPath, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(caPriv), 0o600); err != nil {
+		return nil, nil, err
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse CA cert: %w", err)
+	}
+	return caCert, caPriv, nil
+}
+
+func loadCA(certPath, keyPath string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	caCert, err := readCert(certPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, fmt.Errorf("%s: no PEM data", keyPath)
+	}
+	caPriv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse CA key: %w", err)
+	}
+	return caCert, caPriv, nil
+}
+
+func readCert(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
 // Cleanup removes generated files (does not edit trust stores)
-func Cleanup() error {
+func Cleanup(root string) error {
+	certsDir := certsDir(root)
 	paths := []string{
-		filepath.Join(defaultCertsDir, caCertName),
-		filepath.Join(defaultCertsDir, caKeyName),
-		filepath.Join(defaultCertsDir, serverCertName),
-		filepath.Join(defaultCertsDir, serverKeyName),
-		filepath.Join(defaultCertsDir, fullchainName),
-		filepath.Join(defaultConfigDir, traefikTLSFile),
+		filepath.Join(certsDir, caCertName),
+		filepath.Join(certsDir, caKeyName),
+		filepath.Join(certsDir, serverCertName),
+		filepath.Join(certsDir, serverKeyName),
+		filepath.Join(certsDir, fullchainName),
+		filepath.Join(stage.ProxyDir(root), compose.TraefikTLSFile),
 	}
 	var errs []string
 	for _, p := range paths {
@@ -156,36 +256,12 @@ func Cleanup() error {
 
 // ---- utilities ----
 
-func writePEM(path, typ string, der []byte, mode os.FileMode) error {
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	return pem.Encode(f, &pem.Block{Type: typ, Bytes: der})
+func writePEM(w files.Writer, path, typ string, der []byte, mode os.FileMode) error {
+	return w.WriteFile(path, pemBytes(typ, der), mode)
 }
 
-func concatFiles(dst string, parts ...string) error {
-	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-	for _, p := range parts {
-		b, err := os.ReadFile(p)
-		if err != nil {
-			return err
-		}
-		if _, err := out.Write(b); err != nil {
-			return err
-		}
-		if len(b) > 0 && b[len(b)-1] != '\n' {
-			if _, err := out.Write([]byte("\n")); err != nil {
-				return err
-			}
-		}
-	}
-	return nil
+func pemBytes(typ string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
 }
 
 func mustSubjectKeyID(pub any) []byte {
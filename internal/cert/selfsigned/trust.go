@@ -4,11 +4,22 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/localcompose/locom/internal/config"
+	"github.com/localcompose/locom/internal/stage"
 )
 
 // TrustSetup installs the CA into the OS trust store. Requires privileges on Linux/macOS.
-func TrustSetup() error {
-	caCertPath := filepath.Join(defaultCertsDir, caCertName)
+func TrustSetup(root string, profiles []string) error {
+	cfg, err := config.Load(stage.ConfigPath(root), profiles...)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	if err := requireHTTPS(cfg); err != nil {
+		return err
+	}
+
+	caCertPath := filepath.Join(certsDir(root), caCertName)
 	if _, err := os.Stat(caCertPath); err != nil {
 		return fmt.Errorf("CA not found: %w", err)
 	}
@@ -17,8 +28,8 @@ func TrustSetup() error {
 }
 
 // TrustCleanup removes the CA from the OS trust store using its fingerprint.
-func TrustCleanup() error {
-	caCertPath := filepath.Join(defaultCertsDir, caCertName)
+func TrustCleanup(root string) error {
+	caCertPath := filepath.Join(certsDir(root), caCertName)
 	sha, err := fileSHA1Fingerprint(caCertPath)
 	if err != nil {
 		return err
@@ -0,0 +1,50 @@
+package compose
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/localcompose/locom/internal/config"
+)
+
+// StarterImage answers every request with details about the request and the
+// container, a placeholder until the app's own image is filled in.
+// StarterTCPImage and StarterUDPImage echo what tcp and udp apps receive.
+const (
+	StarterImage    = "traefik/whoami"
+	StarterTCPImage = "traefik/whoamitcp"
+	StarterUDPImage = "traefik/whoamiudp"
+)
+
+// GetStarterAppCompose renders a first compose file for a new app: its
+// service runs the starter image of its protocol on the app's port, attached
+// to the stage network.
+func GetStarterAppCompose(cfg *config.Config, appName string) (ComposeFile, error) {
+	app, ok := cfg.Apps[appName]
+	if !ok {
+		return ComposeFile{}, fmt.Errorf("unknown app %q", appName)
+	}
+	networkName := cfg.Stage.Network.Name
+
+	image, port := StarterImage, strconv.Itoa(app.Port)
+	switch app.Protocol {
+	case config.ProtocolTCP:
+		image, port = StarterTCPImage, ":"+port
+	case config.ProtocolUDP:
+		image, port = StarterUDPImage, ":"+port
+	}
+
+	return ComposeFile{
+		Networks: map[string]Network{
+			networkName: {External: true},
+		},
+		Services: map[string]Service{
+			app.Service: {
+				Image:    image,
+				Restart:  "unless-stopped",
+				Command:  ListOf("--port", port),
+				Networks: Networks(networkName),
+			},
+		},
+	}, nil
+}
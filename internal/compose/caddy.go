@@ -0,0 +1,178 @@
+package compose
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/localcompose/locom/internal/config"
+)
+
+// Caddyfile is the configuration file of the Caddy proxy, in its compose
+// project; Caddy routes apps from it instead of container labels.
+const Caddyfile = "Caddyfile"
+
+type caddyEngine struct{}
+
+func (caddyEngine) ProxyCompose(cfg *config.Config) (ComposeFile, error) {
+	return GetCaddyCompose(cfg)
+}
+
+func (caddyEngine) ProxyFiles(cfg *config.Config) (map[string][]byte, error) {
+	data, err := GetCaddyfile(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{Caddyfile: data}, nil
+}
+
+func (caddyEngine) AppCompose(cfg *config.Config, appName string) (ComposeFile, error) {
+	return GetCaddyAppCompose(cfg, appName)
+}
+
+// TLSFiles returns no files: the Caddyfile references the certificate.
+func (caddyEngine) TLSFiles(cfg *config.Config) (map[string][]byte, error) {
+	return nil, nil
+}
+
+// HealthCheck probes the admin API, which Caddy serves on localhost only.
+func (caddyEngine) HealthCheck(cfg *config.Config) *Healthcheck {
+	return healthcheck("CMD", "wget", "-q", "--spider", "http://localhost:2019/config/")
+}
+
+func checkCaddy(cfg *config.Config) error {
+	proxy := cfg.Stage.Network.Proxy
+	if proxy.Type.Engine != "caddy" {
+		return fmt.Errorf("unsupported proxy engine %q", proxy.Type.Engine)
+	}
+	if supported := config.ProxyVersions["caddy"]; !slices.Contains(supported, proxy.Type.Version) {
+		return fmt.Errorf("unsupported Caddy version %q (supported: %s)", proxy.Type.Version, strings.Join(supported, ", "))
+	}
+	return nil
+}
+
+// GetCaddyCompose renders the proxy's compose file for Caddy: the entrypoint
+// ports of the TLS mode and the Caddyfile written next to it.
+func GetCaddyCompose(cfg *config.Config) (ComposeFile, error) {
+	if err := checkCaddy(cfg); err != nil {
+		return ComposeFile{}, err
+	}
+	proxy := cfg.Stage.Network.Proxy
+	networkName := cfg.Stage.Network.Name
+	bind := cfg.Stage.Network.Bind
+	projectName, containerName := proxyNames(cfg)
+
+	var ports []Port
+	if proxy.TLS.HTTP() {
+		ports = append(ports, publish(bind.Address, bind.Ports.HTTP, 80))
+	}
+	if proxy.TLS.HTTPS() {
+		ports = append(ports, publish(bind.Address, bind.Ports.HTTPS, 443))
+	}
+	volumes := []VolumeMount{ParseVolume("./" + Caddyfile + ":/etc/caddy/Caddyfile:ro")}
+	if proxy.TLS.HTTPS() {
+		volumes = append(volumes, ParseVolume("./certs:"+CertsMount+":ro"))
+	}
+
+	return ComposeFile{
+		Name: projectName,
+		Networks: map[string]Network{
+			networkName: {External: true},
+		},
+		Services: map[string]Service{
+			proxy.Name: {
+				Image:         "caddy:" + proxy.Type.Version,
+				ContainerName: containerName,
+				Restart:       "unless-stopped",
+				Healthcheck:   caddyEngine{}.HealthCheck(cfg),
+				Ports:         ports,
+				Volumes:       volumes,
+				Networks:      Networks(networkName),
+			},
+		},
+	}, nil
+}
+
+// GetCaddyAppCompose renders the compose override that puts an app's service
+// on the stage network, where the Caddyfile reaches it by the app's name.
+func GetCaddyAppCompose(cfg *config.Config, appName string) (ComposeFile, error) {
+	if err := checkCaddy(cfg); err != nil {
+		return ComposeFile{}, err
+	}
+	return aliasAppCompose(cfg, appName)
+}
+
+// GetCaddyfile renders the Caddyfile routing the proxy hostname and every
+// app on the entrypoints of the TLS mode, like the Traefik routers do: https
+// sites use the self-signed certificate, http sites serve or redirect.
+func GetCaddyfile(cfg *config.Config) ([]byte, error) {
+	if err := checkCaddy(cfg); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	b.WriteString("# Generated by locom from .locom/locom.yml, do not edit.\n")
+	b.WriteString("{\n\t# locom sets up certificates and redirects itself\n\tauto_https off\n}\n")
+	for _, s := range fileSites(cfg) {
+		if s.https {
+			fmt.Fprintf(&b, "\nhttps://%s {\n", s.host)
+			fmt.Fprintf(&b, "\ttls %s/%s %s/%s\n", CertsMount, FullchainFile, CertsMount, KeyFile)
+		} else {
+			fmt.Fprintf(&b, "\nhttp://%s {\n", s.host)
+		}
+		writeCaddyRoutes(&b, cfg, s.routes)
+		b.WriteString("}\n")
+	}
+	return []byte(b.String()), nil
+}
+
+// caddyDirective returns the handler directive of a route.
+func caddyDirective(cfg *config.Config, r route) string {
+	switch {
+	case r.redirect:
+		return "redir https://{host}{uri} permanent"
+	case r.app == "":
+		return "respond " + strconv.Quote(proxyStatus(cfg)) + " 200"
+	default:
+		return "reverse_proxy " + r.app + ":" + strconv.Itoa(r.port)
+	}
+}
+
+// writeCaddyRoutes writes the handlers of a site, longest path first; paths
+// no route claims get a 404, as with Traefik.
+func writeCaddyRoutes(b *strings.Builder, cfg *config.Config, routes []route) {
+	type handler struct {
+		path, directive string
+		strip           bool
+	}
+	handlers := make([]handler, len(routes))
+	for i, r := range routes {
+		handlers[i] = handler{r.path, caddyDirective(cfg, r), r.strip}
+	}
+	pathless := slices.ContainsFunc(handlers, func(h handler) bool { return h.path == "" })
+	same := !slices.ContainsFunc(handlers, func(h handler) bool { return h.directive != handlers[0].directive })
+	if pathless && same {
+		// e.g. a redirect of every path
+		fmt.Fprintf(b, "\t%s\n", handlers[0].directive)
+		return
+	}
+	slices.SortStableFunc(handlers, func(a, b handler) int {
+		return cmp.Compare(len(b.path), len(a.path))
+	})
+	if !pathless {
+		handlers = append(handlers, handler{directive: "respond 404"})
+	}
+	for _, h := range handlers {
+		switch {
+		case h.path == "":
+			fmt.Fprintf(b, "\thandle {\n\t\t%s\n\t}\n", h.directive)
+		case h.strip:
+			// handle_path strips the prefix it matches
+			fmt.Fprintf(b, "\thandle_path %s* {\n\t\t%s\n\t}\n", h.path, h.directive)
+		default:
+			fmt.Fprintf(b, "\thandle %s* {\n\t\t%s\n\t}\n", h.path, h.directive)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package compose
+
+import (
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Dynamic is a piece of Traefik dynamic configuration: the routers, services
+// and middlewares of a container, or of a file of the file provider. It is
+// written either as docker labels or as file-provider YAML, both in the order
+// it was built in. Routers, Services and Middlewares are those of http.
+type Dynamic struct {
+	Routers     []Router
+	Services    []LoadBalancer
+	Middlewares []Middleware
+	TCP         TCP
+	UDP         UDP
+	TLS         TLS
+}
+
+// Router routes requests matching Rule on EntryPoints to Service.
+type Router struct {
+	Name        string
+	Rule        string
+	EntryPoints []string
+	Service     string
+	Middlewares []string
+	// TLS terminates TLS on the router; a zero RouterTLS uses the defaults.
+	TLS *RouterTLS
+}
+
+// RouterTLS is the TLS section of a router.
+type RouterTLS struct {
+	Options      string
+	CertResolver string
+}
+
+// LoadBalancer is a service balancing over servers. Docker labels address
+// the labelled container on Port, the file provider the servers at URLs, or
+// at host:port Addresses for tcp and udp.
+type LoadBalancer struct {
+	Name      string
+	Port      int
+	Scheme    string
+	URLs      []string
+	Addresses []string
+}
+
+// TCP is the tcp section: routers match TLS connections by SNI, or any
+// connection with HostSNI(`*`), on their entrypoints.
+type TCP struct {
+	Routers  []TCPRouter
+	Services []LoadBalancer
+}
+
+// TCPRouter routes connections matching Rule on EntryPoints to Service.
+type TCPRouter struct {
+	Name        string
+	Rule        string
+	EntryPoints []string
+	Service     string
+	// TLS accepts TLS connections only, which the router terminates or
+	// passes through; nil routes plain tcp.
+	TLS *TCPRouterTLS
+}
+
+// TCPRouterTLS is the TLS section of a tcp router.
+type TCPRouterTLS struct {
+	Passthrough  bool
+	Options      string
+	CertResolver string
+}
+
+// UDP is the udp section. Datagrams carry no hostname, so routers take
+// everything arriving on their entrypoints.
+type UDP struct {
+	Routers  []UDPRouter
+	Services []LoadBalancer
+}
+
+// UDPRouter routes the datagrams of EntryPoints to Service.
+type UDPRouter struct {
+	Name        string
+	EntryPoints []string
+	Service     string
+}
+
+// Middleware is a named middleware of one Type, such as redirectScheme, with
+// its parameters. The constructors below build the ones locom uses.
+type Middleware struct {
+	Name   string
+	Type   string
+	Params []Param
+}
+
+// Param is a middleware parameter, a single Value or a list of Values.
+type Param struct {
+	Key    string
+	Value  string
+	Values []string
+}
+
+// TLS is the tls section of the file provider. Traefik reads certificates
+// and TLS options from files only, so they have no labels.
+type TLS struct {
+	Certificates []Certificate
+	Options      []TLSOptions
+}
+
+// Certificate is a certificate served by the proxy, with container paths.
+type Certificate struct {
+	CertFile string
+	KeyFile  string
+}
+
+// TLSOptions is a named set of TLS options routers can refer to.
+type TLSOptions struct {
+	Name         string
+	MinVersion   string
+	CipherSuites []string
+	SNIStrict    bool
+}
+
+// RedirectScheme redirects requests to scheme, e.g. https.
+func RedirectScheme(name, scheme string) Middleware {
+	return Middleware{Name: name, Type: "redirectScheme", Params: []Param{{Key: "scheme", Value: scheme}}}
+}
+
+// BasicAuthFile asks for credentials checked against an htpasswd file.
+func BasicAuthFile(name, usersFile string) Middleware {
+	return Middleware{Name: name, Type: "basicAuth", Params: []Param{{Key: "usersFile", Value: usersFile}}}
+}
+
+// StripPrefix removes any of the prefixes from request paths.
+func StripPrefix(name string, prefixes ...string) Middleware {
+	return Middleware{Name: name, Type: "stripPrefix", Params: []Param{{Key: "prefixes", Values: prefixes}}}
+}
+
+// Labels returns the docker labels of the configuration. Keys are lowercase,
+// as Traefik matches them regardless of case.
+func (d Dynamic) Labels() Mapping {
+	var m Mapping
+	set := func(key, value string) {
+		m.Set(strings.ToLower(key), value)
+	}
+	for _, r := range d.Routers {
+		prefix := "traefik.http.routers." + r.Name + "."
+		if r.Rule != "" {
+			set(prefix+"rule", r.Rule)
+		}
+		if len(r.EntryPoints) > 0 {
+			set(prefix+"entryPoints", strings.Join(r.EntryPoints, ","))
+		}
+		if r.Service != "" {
+			set(prefix+"service", r.Service)
+		}
+		if len(r.Middlewares) > 0 {
+			set(prefix+"middlewares", strings.Join(r.Middlewares, ","))
+		}
+		if r.TLS != nil {
+			set(prefix+"tls", "true")
+			if r.TLS.Options != "" {
+				set(prefix+"tls.options", r.TLS.Options)
+			}
+			if r.TLS.CertResolver != "" {
+				set(prefix+"tls.certResolver", r.TLS.CertResolver)
+			}
+		}
+	}
+	services := func(protocol string, lbs []LoadBalancer) {
+		for _, s := range lbs {
+			prefix := "traefik." + protocol + ".services." + s.Name + ".loadBalancer.server."
+			if s.Port != 0 {
+				set(prefix+"port", strconv.Itoa(s.Port))
+			}
+			if s.Scheme != "" {
+				set(prefix+"scheme", s.Scheme)
+			}
+		}
+	}
+	services("http", d.Services)
+	for _, mw := range d.Middlewares {
+		prefix := "traefik.http.middlewares." + mw.Name + "." + mw.Type + "."
+		for _, p := range mw.Params {
+			if p.Values != nil {
+				set(prefix+p.Key, strings.Join(p.Values, ","))
+			} else {
+				set(prefix+p.Key, p.Value)
+			}
+		}
+	}
+	for _, r := range d.TCP.Routers {
+		prefix := "traefik.tcp.routers." + r.Name + "."
+		if r.Rule != "" {
+			set(prefix+"rule", r.Rule)
+		}
+		if len(r.EntryPoints) > 0 {
+			set(prefix+"entryPoints", strings.Join(r.EntryPoints, ","))
+		}
+		if r.Service != "" {
+			set(prefix+"service", r.Service)
+		}
+		if r.TLS != nil {
+			set(prefix+"tls", "true")
+			if r.TLS.Passthrough {
+				set(prefix+"tls.passthrough", "true")
+			}
+			if r.TLS.Options != "" {
+				set(prefix+"tls.options", r.TLS.Options)
+			}
+			if r.TLS.CertResolver != "" {
+				set(prefix+"tls.certResolver", r.TLS.CertResolver)
+			}
+		}
+	}
+	services("tcp", d.TCP.Services)
+	for _, r := range d.UDP.Routers {
+		prefix := "traefik.udp.routers." + r.Name + "."
+		if len(r.EntryPoints) > 0 {
+			set(prefix+"entryPoints", strings.Join(r.EntryPoints, ","))
+		}
+		if r.Service != "" {
+			set(prefix+"service", r.Service)
+		}
+	}
+	services("udp", d.UDP.Services)
+	return m
+}
+
+// MarshalYAML writes the configuration as a file of the file provider.
+func (d Dynamic) MarshalYAML() (any, error) {
+	root := mapNode()
+
+	http := mapNode()
+	if len(d.Routers) > 0 {
+		routers := mapNode()
+		for _, r := range d.Routers {
+			n := mapNode()
+			addScalar(n, "rule", r.Rule)
+			addList(n, "entryPoints", r.EntryPoints)
+			addScalar(n, "service", r.Service)
+			addList(n, "middlewares", r.Middlewares)
+			if r.TLS != nil {
+				tls := mapNode()
+				addScalar(tls, "options", r.TLS.Options)
+				addScalar(tls, "certResolver", r.TLS.CertResolver)
+				addNode(n, "tls", tls)
+			}
+			addNode(routers, r.Name, n)
+		}
+		addNode(http, "routers", routers)
+	}
+	if len(d.Services) > 0 {
+		addNode(http, "services", loadBalancers(d.Services))
+	}
+	if len(d.Middlewares) > 0 {
+		middlewares := mapNode()
+		for _, mw := range d.Middlewares {
+			params := mapNode()
+			for _, p := range mw.Params {
+				if p.Values != nil {
+					addList(params, p.Key, p.Values)
+				} else {
+					addScalar(params, p.Key, p.Value)
+				}
+			}
+			n := mapNode()
+			addNode(n, mw.Type, params)
+			addNode(middlewares, mw.Name, n)
+		}
+		addNode(http, "middlewares", middlewares)
+	}
+	if len(http.Content) > 0 {
+		addNode(root, "http", http)
+	}
+
+	tcp := mapNode()
+	if len(d.TCP.Routers) > 0 {
+		routers := mapNode()
+		for _, r := range d.TCP.Routers {
+			n := mapNode()
+			addScalar(n, "rule", r.Rule)
+			addList(n, "entryPoints", r.EntryPoints)
+			addScalar(n, "service", r.Service)
+			if r.TLS != nil {
+				tls := mapNode()
+				addBool(tls, "passthrough", r.TLS.Passthrough)
+				addScalar(tls, "options", r.TLS.Options)
+				addScalar(tls, "certResolver", r.TLS.CertResolver)
+				addNode(n, "tls", tls)
+			}
+			addNode(routers, r.Name, n)
+		}
+		addNode(tcp, "routers", routers)
+	}
+	if len(d.TCP.Services) > 0 {
+		addNode(tcp, "services", loadBalancers(d.TCP.Services))
+	}
+	if len(tcp.Content) > 0 {
+		addNode(root, "tcp", tcp)
+	}
+
+	udp := mapNode()
+	if len(d.UDP.Routers) > 0 {
+		routers := mapNode()
+		for _, r := range d.UDP.Routers {
+			n := mapNode()
+			addList(n, "entryPoints", r.EntryPoints)
+			addScalar(n, "service", r.Service)
+			addNode(routers, r.Name, n)
+		}
+		addNode(udp, "routers", routers)
+	}
+	if len(d.UDP.Services) > 0 {
+		addNode(udp, "services", loadBalancers(d.UDP.Services))
+	}
+	if len(udp.Content) > 0 {
+		addNode(root, "udp", udp)
+	}
+
+	tls := mapNode()
+	if len(d.TLS.Certificates) > 0 {
+		certs := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, c := range d.TLS.Certificates {
+			n := mapNode()
+			addScalar(n, "certFile", c.CertFile)
+			addScalar(n, "keyFile", c.KeyFile)
+			certs.Content = append(certs.Content, n)
+		}
+		addNode(tls, "certificates", certs)
+	}
+	if len(d.TLS.Options) > 0 {
+		options := mapNode()
+		for _, o := range d.TLS.Options {
+			n := mapNode()
+			addScalar(n, "minVersion", o.MinVersion)
+			addList(n, "cipherSuites", o.CipherSuites)
+			addBool(n, "sniStrict", o.SNIStrict)
+			addNode(options, o.Name, n)
+		}
+		addNode(tls, "options", options)
+	}
+	if len(tls.Content) > 0 {
+		addNode(root, "tls", tls)
+	}
+	return root, nil
+}
+
+// loadBalancers writes services balancing over their URLs and Addresses.
+func loadBalancers(lbs []LoadBalancer) *yaml.Node {
+	services := mapNode()
+	for _, s := range lbs {
+		servers := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, url := range s.URLs {
+			server := mapNode()
+			addScalar(server, "url", url)
+			servers.Content = append(servers.Content, server)
+		}
+		for _, address := range s.Addresses {
+			server := mapNode()
+			addScalar(server, "address", address)
+			servers.Content = append(servers.Content, server)
+		}
+		lb := mapNode()
+		addNode(lb, "servers", servers)
+		n := mapNode()
+		addNode(n, "loadBalancer", lb)
+		addNode(services, s.Name, n)
+	}
+	return services
+}
+
+func mapNode() *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode}
+}
+
+func addNode(m *yaml.Node, key string, value *yaml.Node) {
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+}
+
+// addScalar adds a string value unless it is empty.
+func addScalar(m *yaml.Node, key, value string) {
+	if value != "" {
+		addNode(m, key, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+	}
+}
+
+// addBool adds a true value; false is the default.
+func addBool(m *yaml.Node, key string, value bool) {
+	if value {
+		addNode(m, key, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"})
+	}
+}
+
+// addList adds a list of strings unless it is empty.
+func addList(m *yaml.Node, key string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	seq := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, v := range values {
+		seq.Content = append(seq.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v})
+	}
+	addNode(m, key, seq)
+}
@@ -0,0 +1,181 @@
+package compose_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/localcompose/locom/internal/compose"
+	"github.com/localcompose/locom/internal/config"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with testdata/name, or rewrites it with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s differs (run go test -update to accept):\n--- got\n%s\n--- want\n%s", path, got, want)
+	}
+}
+
+func labelLines(m compose.Mapping) []byte {
+	var b strings.Builder
+	for _, e := range m.Entries {
+		b.WriteString(e.Key + "=" + *e.Value + "\n")
+	}
+	return []byte(b.String())
+}
+
+func TestDynamic(t *testing.T) {
+	d := compose.Dynamic{
+		Routers: []compose.Router{
+			{Name: "shop", Rule: "Host(`shop.locom.self`)", EntryPoints: []string{"web"}, Middlewares: []string{"redirect-to-https"}},
+			{Name: "shop-secure", Rule: "Host(`shop.locom.self`)", EntryPoints: []string{"websecure"}, Service: "shop",
+				Middlewares: []string{"shop-auth", "shop-strip"}, TLS: &compose.RouterTLS{Options: "modern@file"}},
+		},
+		Services: []compose.LoadBalancer{
+			{Name: "shop", Port: 3000, URLs: []string{"http://shop:3000"}},
+		},
+		Middlewares: []compose.Middleware{
+			compose.RedirectScheme("redirect-to-https", "https"),
+			compose.BasicAuthFile("shop-auth", "/etc/traefik/shop.htpasswd"),
+			compose.StripPrefix("shop-strip", "/api"),
+		},
+		TCP: compose.TCP{
+			Routers: []compose.TCPRouter{
+				{Name: "db", Rule: "HostSNI(`db.locom.self`)", EntryPoints: []string{"tcp-5432"}, Service: "db", TLS: &compose.TCPRouterTLS{}},
+				{Name: "vault", Rule: "HostSNI(`vault.locom.self`)", EntryPoints: []string{"tcp-5432"}, Service: "vault", TLS: &compose.TCPRouterTLS{Passthrough: true}},
+				{Name: "redis", Rule: "HostSNI(`*`)", EntryPoints: []string{"tcp-6379"}, Service: "redis"},
+			},
+			Services: []compose.LoadBalancer{
+				{Name: "db", Port: 5432, Addresses: []string{"db:5432"}},
+			},
+		},
+		UDP: compose.UDP{
+			Routers:  []compose.UDPRouter{{Name: "dns", EntryPoints: []string{"udp-5353"}, Service: "dns"}},
+			Services: []compose.LoadBalancer{{Name: "dns", Port: 53, Addresses: []string{"dns:53"}}},
+		},
+		TLS: compose.TLS{
+			Certificates: []compose.Certificate{{CertFile: "/certs/shop.crt", KeyFile: "/certs/shop.key"}},
+			Options:      []compose.TLSOptions{{Name: "modern", MinVersion: "VersionTLS13", SNIStrict: true}},
+		},
+	}
+
+	golden(t, "dynamic.labels", labelLines(d.Labels()))
+
+	data, err := yaml.Marshal(d)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	golden(t, "dynamic.yml", data)
+}
+
+func TestGetTraefikCompose_Golden(t *testing.T) {
+	for _, mode := range config.TLSModes {
+		c := newConfig("locom", "3.1")
+		c.Stage.Network.Bind = config.Bind{Address: "127.0.0.1", Ports: config.Ports{HTTP: 80, HTTPS: 443, Dashboard: 8080}}
+		c.Stage.Network.Proxy.TLS = mode
+		c.Apps = map[string]config.App{
+			"shop": {Dir: "shop", Service: "web", Host: "shop", Port: 3000},
+		}
+
+		proxy, err := compose.GetTraefikCompose(c)
+		if err != nil {
+			t.Fatalf("mode %s: GetTraefikCompose failed: %v", mode, err)
+		}
+		app, err := compose.GetTraefikAppCompose(c, "shop")
+		if err != nil {
+			t.Fatalf("mode %s: GetTraefikAppCompose failed: %v", mode, err)
+		}
+		for kind, file := range map[string]compose.ComposeFile{"proxy": proxy, "app": app} {
+			data, err := yaml.Marshal(file)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			golden(t, kind+"-"+string(mode)+".yml", data)
+		}
+	}
+
+	c := newConfig("locom", "2.10")
+	insecure := false
+	c.Stage.Network.Proxy.Dashboard = config.Dashboard{Insecure: &insecure, User: "admin"}
+	proxy, err := compose.GetTraefikCompose(c)
+	if err != nil {
+		t.Fatalf("GetTraefikCompose failed: %v", err)
+	}
+	golden(t, "proxy-dashboard-user.labels", labelLines(proxy.Services["traefik"].Labels))
+}
+
+func TestGetTraefikCompose_Stream(t *testing.T) {
+	for _, version := range []string{"2.10", "3.1"} {
+		c := newConfig("locom", version)
+		c.Stage.Network.Bind = config.Bind{Address: "127.0.0.1", Ports: config.Ports{HTTP: 80, HTTPS: 443, Dashboard: 8080}}
+		enabled, plain := true, false
+		c.Apps = map[string]config.App{
+			"db":    {Service: "postgres", Host: "db", Port: 5432, TLS: &enabled, Aliases: []string{"pg"}, Protocol: "tcp", EntryPoint: 5432},
+			"vault": {Service: "vault", Host: "vault", Port: 8200, TLS: &enabled, Protocol: "tcp", EntryPoint: 5432, Passthrough: true},
+			"redis": {Service: "redis", Host: "redis", Port: 6379, TLS: &plain, Protocol: "tcp", EntryPoint: 6379},
+			"dns":   {Service: "coredns", Host: "dns", Port: 53, TLS: &enabled, Protocol: "udp", EntryPoint: 5353},
+		}
+
+		proxy, err := compose.GetTraefikCompose(c)
+		if err != nil {
+			t.Fatalf("GetTraefikCompose failed: %v", err)
+		}
+		data, err := yaml.Marshal(proxy)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		golden(t, "proxy-stream-v"+version[:1]+".yml", data)
+
+		var labels []byte
+		for _, name := range []string{"db", "dns", "redis", "vault"} {
+			app, err := compose.GetTraefikAppCompose(c, name)
+			if err != nil {
+				t.Fatalf("GetTraefikAppCompose(%s) failed: %v", name, err)
+			}
+			labels = append(labels, labelLines(app.Services[c.Apps[name].Service].Labels)...)
+		}
+		golden(t, "app-stream-v"+version[:1]+".labels", labels)
+	}
+}
+
+func TestGetTraefikAppCompose_Rules(t *testing.T) {
+	for _, version := range []string{"2.10", "3.1"} {
+		c := newConfig("locom", version)
+		c.Apps = map[string]config.App{
+			"hooks":  {Service: "hooks", Host: "proxy", Port: 8000, Path: "/hooks", Strip: true},
+			"beta":   {Service: "beta", Host: "shop", Port: 3000, Aliases: []string{"www"}, Headers: map[string]string{"X-Channel": "beta", "X-Tenant": "acme"}},
+			"static": {Service: "static", Host: "shop", Port: 80, Aliases: []string{"www"}, Path: "/static", Strip: true},
+		}
+
+		var labels []byte
+		for _, name := range []string{"beta", "hooks", "static"} {
+			app, err := compose.GetTraefikAppCompose(c, name)
+			if err != nil {
+				t.Fatalf("GetTraefikAppCompose(%s) failed: %v", name, err)
+			}
+			labels = append(labels, labelLines(app.Services[c.Apps[name].Service].Labels)...)
+		}
+		golden(t, "app-rules-v"+version[:1]+".labels", labels)
+	}
+}
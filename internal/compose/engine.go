@@ -0,0 +1,159 @@
+package compose
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/localcompose/locom/internal/config"
+)
+
+// ProxyEngine generates the proxy of a stage and the routing of its apps for
+// a proxy implementation. Engines are registered by the name set in
+// stage.network.proxy.type.engine.
+type ProxyEngine interface {
+	// ProxyCompose renders the compose file of the proxy, with a
+	// healthcheck probing its health endpoint.
+	ProxyCompose(cfg *config.Config) (ComposeFile, error)
+	// ProxyFiles renders the configuration files the proxy reads, by path
+	// relative to its compose project. Engines not configured through labels
+	// route every app from these files.
+	ProxyFiles(cfg *config.Config) (map[string][]byte, error)
+	// AppCompose renders the compose override that routes an app through
+	// the proxy.
+	AppCompose(cfg *config.Config, appName string) (ComposeFile, error)
+	// TLSFiles renders the configuration loading the certificate of locom
+	// cert selfsigned setup, by path relative to the proxy's compose project.
+	// Engines referencing the certificate from ProxyFiles return none.
+	TLSFiles(cfg *config.Config) (map[string][]byte, error)
+	// HealthCheck returns the compose healthcheck probing the health
+	// endpoint of the proxy from inside its container.
+	HealthCheck(cfg *config.Config) *Healthcheck
+}
+
+// engines is the registry of proxy engines, by stage.network.proxy.type.engine.
+var engines = map[string]ProxyEngine{
+	"traefik": traefikEngine{},
+	"caddy":   caddyEngine{},
+	"nginx":   nginxEngine{},
+}
+
+// Engines returns the names of the registered proxy engines, sorted.
+func Engines() []string {
+	return slices.Sorted(maps.Keys(engines))
+}
+
+// EngineFor returns the engine of the stage's proxy.
+func EngineFor(cfg *config.Config) (ProxyEngine, error) {
+	engine := cfg.Stage.Network.Proxy.Type.Engine
+	e, ok := engines[engine]
+	if !ok {
+		return nil, fmt.Errorf("unsupported proxy engine %q", engine)
+	}
+	return e, nil
+}
+
+// healthcheck probes the proxy every 10 seconds.
+func healthcheck(test ...string) *Healthcheck {
+	return &Healthcheck{Test: ListOf(test...), Interval: "10s", Timeout: "3s"}
+}
+
+// Container paths of the certificate issued by locom cert selfsigned setup,
+// mounted from the certs folder of the proxy.
+const (
+	CertsMount    = "/certs"
+	FullchainFile = "selfsigned.server.fullchain.crt"
+	KeyFile       = "selfsigned.server.key"
+)
+
+// aliasAppCompose renders the compose override that puts an app's service on
+// the stage network under the app's name, for the engines routing apps from
+// their configuration files.
+func aliasAppCompose(cfg *config.Config, appName string) (ComposeFile, error) {
+	app, ok := cfg.Apps[appName]
+	if !ok {
+		return ComposeFile{}, fmt.Errorf("unknown app %q", appName)
+	}
+	networkName := cfg.Stage.Network.Name
+
+	return ComposeFile{
+		Networks: map[string]Network{
+			networkName: {External: true},
+		},
+		Services: map[string]Service{
+			app.Service: {
+				// service names may repeat across projects, app names not
+				Networks: Attachments{{Network: networkName, Aliases: []string{appName}}},
+			},
+		},
+	}, nil
+}
+
+// site is a hostname served on one entrypoint, for the engines routing apps
+// from their configuration files.
+type site struct {
+	host   string
+	https  bool
+	routes []route
+}
+
+// route is what a site does with the requests below path: redirect them to
+// https, proxy them to the port of an app, with path stripped when strip is
+// set, or, without app, answer for the proxy itself.
+type route struct {
+	path     string
+	strip    bool
+	redirect bool
+	app      string
+	port     int
+}
+
+// fileSites lists the sites of a stage on the entrypoints of its TLS mode,
+// like the Traefik routers: the proxy hostname first, then apps by name.
+func fileSites(cfg *config.Config) []site {
+	mode := cfg.Stage.Network.Proxy.TLS
+
+	var sites []site
+	add := func(host string, https bool, r route) {
+		i := slices.IndexFunc(sites, func(s site) bool { return s.host == host && s.https == https })
+		if i < 0 {
+			sites = append(sites, site{host: host, https: https})
+			i = len(sites) - 1
+		}
+		sites[i].routes = append(sites[i].routes, r)
+	}
+	serve := func(host string, r route, https, redirect bool) {
+		if https {
+			add(host, true, r)
+		}
+		switch {
+		case redirect:
+			add(host, false, route{path: r.path, redirect: true})
+		case mode.HTTP():
+			add(host, false, r)
+		}
+	}
+
+	serve(cfg.ProxyHostname(), route{}, mode.HTTPS(), mode == config.TLSRedirect)
+	for _, name := range slices.Sorted(maps.Keys(cfg.Apps)) {
+		app := cfg.Apps[name]
+		if !app.HTTP() {
+			continue
+		}
+		https := app.TLSEnabled() && mode.HTTPS()
+		r := route{path: app.Path, strip: app.Strip, app: name, port: app.Port}
+		for _, host := range append([]string{app.Host}, app.Aliases...) {
+			serve(cfg.Hostname(host), r, https, https && mode == config.TLSRedirect)
+		}
+	}
+	return sites
+}
+
+// proxyStatus is the answer of the proxy hostname on engines without
+// dashboard.
+func proxyStatus(cfg *config.Config) string {
+	if cfg.Stage.Name == "" {
+		return "locom stage: proxy is up"
+	}
+	return "locom stage " + cfg.Stage.Name + ": proxy is up"
+}
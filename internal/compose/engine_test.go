@@ -0,0 +1,206 @@
+package compose_test
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/localcompose/locom/internal/compose"
+	"github.com/localcompose/locom/internal/config"
+)
+
+// newEngineConfig returns a stage of the engine with apps sharing a hostname
+// by path, one stripping it, an alias and an app without https.
+func newEngineConfig(engine string, mode config.TLSMode) *config.Config {
+	c := newConfig("locom", config.DefaultProxyVersions[engine])
+	c.Stage.Name = "shop"
+	c.Stage.Network.Proxy.Name = engine
+	c.Stage.Network.Proxy.Type.Engine = engine
+	c.Stage.Network.Proxy.TLS = mode
+	c.Stage.Network.Bind = config.Bind{Address: "127.0.0.1", Ports: config.Ports{HTTP: 80, HTTPS: 443, Dashboard: 8080}}
+	plain := false
+	c.Apps = map[string]config.App{
+		"shop": {Dir: "shop", Service: "web", Host: "shop", Port: 3000, Aliases: []string{"www"}},
+		"api":  {Dir: "api", Service: "api", Host: "shop", Port: 8000, Path: "/api", Strip: true},
+		"docs": {Dir: "docs", Service: "docs", Host: "docs", Port: 80, TLS: &plain},
+	}
+	return c
+}
+
+func TestEngines_Registered(t *testing.T) {
+	supported := slices.Sorted(maps.Keys(config.ProxyVersions))
+	if got := compose.Engines(); !slices.Equal(got, supported) {
+		t.Errorf("expected an engine for each of config.ProxyVersions %v, got %v", supported, got)
+	}
+
+	c := newConfig("locom", "1.0")
+	c.Stage.Network.Proxy.Type.Engine = "haproxy"
+	if _, err := compose.EngineFor(c); err == nil {
+		t.Error("expected an error for an unknown engine")
+	}
+}
+
+// TestEngines_Conformance renders the same stage with every engine, in every
+// TLS mode, against golden files in testdata/engines/<engine>, and checks
+// what all engines must do alike.
+func TestEngines_Conformance(t *testing.T) {
+	for _, engine := range compose.Engines() {
+		for _, mode := range config.TLSModes {
+			t.Run(engine+"/"+string(mode), func(t *testing.T) {
+				checkEngine(t, engine, mode)
+			})
+		}
+	}
+}
+
+func checkEngine(t *testing.T, engine string, mode config.TLSMode) {
+	c := newEngineConfig(engine, mode)
+	e, err := compose.EngineFor(c)
+	if err != nil {
+		t.Fatalf("EngineFor failed: %v", err)
+	}
+	dir := filepath.Join("engines", engine)
+
+	// the proxy service, on the stage network, publishing the entrypoints
+	// of the mode
+	proxy, err := e.ProxyCompose(c)
+	if err != nil {
+		t.Fatalf("ProxyCompose failed: %v", err)
+	}
+	golden(t, filepath.Join(dir, "proxy-"+string(mode)+".yml"), marshal(t, proxy))
+	svc, ok := proxy.Services[engine]
+	if !ok || len(proxy.Services) != 1 {
+		t.Fatalf("expected the single service %s, got %v", engine, slices.Collect(maps.Keys(proxy.Services)))
+	}
+	if proxy.Name != "shop-proxy" || svc.ContainerName != "shop-"+engine {
+		t.Errorf("expected the proxy named after the stage, got project %q and container %q", proxy.Name, svc.ContainerName)
+	}
+	if !proxy.Networks["locom"].External || len(svc.Networks) != 1 || svc.Networks[0].Network != "locom" {
+		t.Errorf("expected the proxy on the external stage network, got %+v", svc.Networks)
+	}
+	var published []string
+	for _, p := range svc.Ports {
+		if p.HostIP != "127.0.0.1" {
+			t.Errorf("expected ports bound to 127.0.0.1, got %+v", p)
+		}
+		if p.Target == 80 || p.Target == 443 {
+			published = append(published, p.Published)
+		}
+	}
+	var want []string
+	if mode.HTTP() {
+		want = append(want, "80")
+	}
+	if mode.HTTPS() {
+		want = append(want, "443")
+	}
+	if !slices.Equal(published, want) {
+		t.Errorf("expected entrypoints %v published, got %v", want, published)
+	}
+	mountsCerts := slices.ContainsFunc(svc.Volumes, func(v compose.VolumeMount) bool { return v.Target == compose.CertsMount })
+	if mountsCerts != mode.HTTPS() {
+		t.Errorf("expected the certificates mounted only with https, got %v", svc.Volumes)
+	}
+	if svc.Healthcheck == nil || !slices.Equal(svc.Healthcheck.Test.List, e.HealthCheck(c).Test.List) {
+		t.Errorf("expected the healthcheck of the engine, got %+v", svc.Healthcheck)
+	}
+
+	// the routing of every hostname, from labels or proxy files
+	routing := string(marshal(t, proxy))
+	proxyFiles, err := e.ProxyFiles(c)
+	if err != nil {
+		t.Fatalf("ProxyFiles failed: %v", err)
+	}
+	for _, name := range slices.Sorted(maps.Keys(proxyFiles)) {
+		golden(t, filepath.Join(dir, string(mode)+"-"+filepath.Base(name)), proxyFiles[name])
+		routing += string(proxyFiles[name])
+	}
+	unnamed := newEngineConfig(engine, mode)
+	unnamed.Stage.Name = ""
+	unnamedFiles, err := e.ProxyFiles(unnamed)
+	if err != nil {
+		t.Fatalf("ProxyFiles without a stage name failed: %v", err)
+	}
+	for name, data := range unnamedFiles {
+		if strings.Contains(string(data), "stage :") {
+			t.Errorf("expected no empty stage name in %s:\n%s", name, data)
+		}
+	}
+	var apps strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(c.Apps)) {
+		override, err := e.AppCompose(c, name)
+		if err != nil {
+			t.Fatalf("AppCompose(%s) failed: %v", name, err)
+		}
+		app := c.Apps[name]
+		attached, ok := override.Services[app.Service]
+		i := slices.IndexFunc(attached.Networks, func(a compose.Attachment) bool { return a.Network == "locom" })
+		if !ok || i < 0 {
+			t.Errorf("expected %s's service %s on the stage network, got %+v", name, app.Service, override.Services)
+		} else if attached.Labels.IsZero() && !slices.Equal(attached.Networks[i].Aliases, []string{name}) {
+			// without labels, the proxy reaches the app by its name
+			t.Errorf("expected %s's service on the stage network as %s, got %+v", name, name, attached.Networks[i])
+		}
+		data := marshal(t, override)
+		apps.WriteString("# " + name + "\n")
+		apps.Write(data)
+		routing += string(data)
+	}
+	golden(t, filepath.Join(dir, "apps-"+string(mode)+".yml"), []byte(apps.String()))
+	served := []string{c.ProxyHostname()}
+	for _, app := range c.Apps {
+		// an app without https has no entrypoint when only https is served
+		if mode.HTTP() || app.TLSEnabled() {
+			for _, host := range append([]string{app.Host}, app.Aliases...) {
+				served = append(served, c.Hostname(host))
+			}
+		}
+	}
+	for _, host := range c.Hostnames() {
+		want, routed := slices.Contains(served, host), strings.Contains(routing, host)
+		if routed != want {
+			t.Errorf("%s: expected routed %v, got %v", host, want, routed)
+		}
+	}
+	if _, err := e.AppCompose(c, "blog"); err == nil {
+		t.Error("expected an error for an unknown app")
+	}
+
+	// the configuration loading the certificate, with https only
+	tlsFiles, err := e.TLSFiles(c)
+	if err != nil {
+		t.Fatalf("TLSFiles failed: %v", err)
+	}
+	if !mode.HTTPS() && len(tlsFiles) > 0 {
+		t.Errorf("expected no TLS files without https, got %v", slices.Collect(maps.Keys(tlsFiles)))
+	}
+	for _, name := range slices.Sorted(maps.Keys(tlsFiles)) {
+		golden(t, filepath.Join(dir, string(mode)+"-tls-"+filepath.Base(name)), tlsFiles[name])
+		if !strings.Contains(string(tlsFiles[name]), compose.CertsMount+"/"+compose.FullchainFile) {
+			t.Errorf("expected %s to load the fullchain", name)
+		}
+	}
+
+	// configurations of other engines are refused
+	other := newEngineConfig(engine, mode)
+	other.Stage.Network.Proxy.Type.Engine = "other"
+	if _, err := e.ProxyCompose(other); err == nil {
+		t.Error("expected ProxyCompose to refuse another engine")
+	}
+	if _, err := e.AppCompose(other, "shop"); err == nil {
+		t.Error("expected AppCompose to refuse another engine")
+	}
+}
+
+func marshal(t *testing.T, v any) []byte {
+	t.Helper()
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	return data
+}
@@ -0,0 +1,198 @@
+package compose
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/localcompose/locom/internal/config"
+)
+
+// NginxConf is the configuration file of the nginx proxy, in its compose
+// project. It replaces the default server of the image.
+const NginxConf = "locom.conf"
+
+type nginxEngine struct{}
+
+func (nginxEngine) ProxyCompose(cfg *config.Config) (ComposeFile, error) {
+	return GetNginxCompose(cfg)
+}
+
+func (nginxEngine) ProxyFiles(cfg *config.Config) (map[string][]byte, error) {
+	data, err := GetNginxConf(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{NginxConf: data}, nil
+}
+
+func (nginxEngine) AppCompose(cfg *config.Config, appName string) (ComposeFile, error) {
+	return GetNginxAppCompose(cfg, appName)
+}
+
+// TLSFiles returns no files: the server blocks reference the certificate.
+func (nginxEngine) TLSFiles(cfg *config.Config) (map[string][]byte, error) {
+	return nil, nil
+}
+
+// nginxHealthAddress serves the health endpoint inside the container only.
+const nginxHealthAddress = "127.0.0.1:8081"
+
+// HealthCheck probes the health endpoint of the server blocks.
+func (nginxEngine) HealthCheck(cfg *config.Config) *Healthcheck {
+	return healthcheck("CMD", "wget", "-q", "--spider", "http://"+nginxHealthAddress+"/health")
+}
+
+func checkNginx(cfg *config.Config) error {
+	proxy := cfg.Stage.Network.Proxy
+	if proxy.Type.Engine != "nginx" {
+		return fmt.Errorf("unsupported proxy engine %q", proxy.Type.Engine)
+	}
+	if supported := config.ProxyVersions["nginx"]; !slices.Contains(supported, proxy.Type.Version) {
+		return fmt.Errorf("unsupported nginx version %q (supported: %s)", proxy.Type.Version, strings.Join(supported, ", "))
+	}
+	return nil
+}
+
+// GetNginxCompose renders the proxy's compose file for nginx: the entrypoint
+// ports of the TLS mode and the server blocks written next to it.
+func GetNginxCompose(cfg *config.Config) (ComposeFile, error) {
+	if err := checkNginx(cfg); err != nil {
+		return ComposeFile{}, err
+	}
+	proxy := cfg.Stage.Network.Proxy
+	networkName := cfg.Stage.Network.Name
+	bind := cfg.Stage.Network.Bind
+	projectName, containerName := proxyNames(cfg)
+
+	var ports []Port
+	if proxy.TLS.HTTP() {
+		ports = append(ports, publish(bind.Address, bind.Ports.HTTP, 80))
+	}
+	if proxy.TLS.HTTPS() {
+		ports = append(ports, publish(bind.Address, bind.Ports.HTTPS, 443))
+	}
+	volumes := []VolumeMount{ParseVolume("./" + NginxConf + ":/etc/nginx/conf.d/default.conf:ro")}
+	if proxy.TLS.HTTPS() {
+		volumes = append(volumes, ParseVolume("./certs:"+CertsMount+":ro"))
+	}
+
+	return ComposeFile{
+		Name: projectName,
+		Networks: map[string]Network{
+			networkName: {External: true},
+		},
+		Services: map[string]Service{
+			proxy.Name: {
+				// the alpine variant has wget for the healthcheck
+				Image:         "nginx:" + proxy.Type.Version + "-alpine",
+				ContainerName: containerName,
+				Restart:       "unless-stopped",
+				Healthcheck:   nginxEngine{}.HealthCheck(cfg),
+				Ports:         ports,
+				Volumes:       volumes,
+				Networks:      Networks(networkName),
+			},
+		},
+	}, nil
+}
+
+// GetNginxAppCompose renders the compose override that puts an app's service
+// on the stage network, where the server blocks reach it by the app's name.
+func GetNginxAppCompose(cfg *config.Config, appName string) (ComposeFile, error) {
+	if err := checkNginx(cfg); err != nil {
+		return ComposeFile{}, err
+	}
+	return aliasAppCompose(cfg, appName)
+}
+
+// nginxHeader is included in the http context: apps are resolved per request
+// through Docker's DNS, so they may start after the proxy, and websocket
+// upgrades are passed on.
+const nginxHeader = `# Generated by locom from .locom/locom.yml, do not edit.
+resolver 127.0.0.11 valid=10s ipv6=off;
+
+map $http_upgrade $connection_upgrade {
+    default upgrade;
+    ''      close;
+}
+
+proxy_http_version 1.1;
+proxy_set_header Host $host;
+proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+proxy_set_header X-Forwarded-Proto $scheme;
+proxy_set_header Upgrade $http_upgrade;
+proxy_set_header Connection $connection_upgrade;
+`
+
+// GetNginxConf renders the server blocks routing the proxy hostname and every
+// app on the entrypoints of the TLS mode, like the Traefik routers do: https
+// servers use the self-signed certificate, http servers serve or redirect,
+// unknown hostnames get a 404. Another server answers the health endpoint.
+func GetNginxConf(cfg *config.Config) ([]byte, error) {
+	if err := checkNginx(cfg); err != nil {
+		return nil, err
+	}
+	mode := cfg.Stage.Network.Proxy.TLS
+	tls := fmt.Sprintf("    ssl_certificate %s/%s;\n    ssl_certificate_key %s/%s;\n", CertsMount, FullchainFile, CertsMount, KeyFile)
+
+	var b strings.Builder
+	b.WriteString(nginxHeader)
+	fmt.Fprintf(&b, "\nserver {\n    listen %s;\n\n    location = /health {\n        access_log off;\n        return 200 \"ok\\n\";\n    }\n}\n", nginxHealthAddress)
+	if mode.HTTP() {
+		b.WriteString("\nserver {\n    listen 80 default_server;\n    return 404;\n}\n")
+	}
+	if mode.HTTPS() {
+		b.WriteString("\nserver {\n    listen 443 ssl default_server;\n" + tls + "    return 404;\n}\n")
+	}
+	for _, s := range fileSites(cfg) {
+		if s.https {
+			fmt.Fprintf(&b, "\nserver {\n    listen 443 ssl;\n    server_name %s;\n%s", s.host, tls)
+		} else {
+			fmt.Fprintf(&b, "\nserver {\n    listen 80;\n    server_name %s;\n", s.host)
+		}
+		writeNginxLocations(&b, cfg, s.routes)
+		b.WriteString("}\n")
+	}
+	return []byte(b.String()), nil
+}
+
+// nginxDirectives returns the directives of a route's location.
+func nginxDirectives(cfg *config.Config, r route) string {
+	switch {
+	case r.redirect:
+		return "return 301 https://$host$request_uri;"
+	case r.app == "":
+		return "default_type text/plain;\n        return 200 " + strconv.Quote(proxyStatus(cfg)+"\n") + ";"
+	case r.strip:
+		// the rewritten uri is passed on in place of the request's
+		return "rewrite ^" + regexp.QuoteMeta(r.path) + "/?(.*)$ /$1 break;\n        " + nginxDirectives(cfg, route{app: r.app, port: r.port})
+	default:
+		// a variable defers resolving the app to the request
+		return "set $upstream " + r.app + ":" + strconv.Itoa(r.port) + ";\n        proxy_pass http://$upstream;"
+	}
+}
+
+// writeNginxLocations writes a location per route; nginx picks the longest
+// matching prefix itself. Paths no route claims get a 404, as with Traefik.
+func writeNginxLocations(b *strings.Builder, cfg *config.Config, routes []route) {
+	type location struct{ path, directives string }
+	locations := make([]location, len(routes))
+	for i, r := range routes {
+		locations[i] = location{cmp.Or(r.path, "/"), nginxDirectives(cfg, r)}
+	}
+	pathless := slices.ContainsFunc(routes, func(r route) bool { return r.path == "" })
+	same := !slices.ContainsFunc(locations, func(l location) bool { return l.directives != locations[0].directives })
+	if pathless && same {
+		// e.g. a redirect of every path
+		locations = []location{{"/", locations[0].directives}}
+	} else if !pathless {
+		locations = append(locations, location{"/", "return 404;"})
+	}
+	for _, l := range locations {
+		fmt.Fprintf(b, "\n    location %s {\n        %s\n    }\n", l.path, l.directives)
+	}
+}
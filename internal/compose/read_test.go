@@ -0,0 +1,261 @@
+package compose_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/localcompose/locom/internal/compose"
+)
+
+const fullCompose = `name: shop
+x-defaults: &defaults
+  restart: unless-stopped
+services:
+  web:
+    <<: *defaults
+    build: ./web
+    image: shop/web
+    profiles: [dev]
+    command: npm start
+    environment:
+      - NODE_ENV=development
+      - DEBUG
+    depends_on:
+      db:
+        condition: service_healthy
+      cache:
+        condition: service_started
+        required: false
+    ports:
+      - "8080:80"
+      - 127.0.0.1:8443:443
+      - "[::1]:9000:9000/udp"
+      - target: 3000
+        published: "3000"
+        host_ip: 0.0.0.0
+        mode: host
+    volumes:
+      - ./src:/app/src:ro
+      - type: volume
+        source: node_modules
+        target: /app/node_modules
+        volume:
+          nocopy: true
+    networks:
+      front:
+        aliases: [shop]
+      back:
+    extra_hosts:
+      - host.docker.internal:host-gateway
+    labels:
+      com.example.team: shop
+    x-owner: team-shop
+    deploy:
+      replicas: 2
+  db:
+    image: postgres:16
+    build:
+      context: ./db
+      args:
+        PG_VERSION: "16"
+    entrypoint: [docker-entrypoint.sh]
+    environment:
+      POSTGRES_PASSWORD: secret
+      PGDATA:
+    expose: ["5432"]
+    healthcheck:
+      test: [CMD-SHELL, pg_isready]
+      interval: 5s
+      retries: 5
+    networks: [back]
+  cache:
+    image: redis
+    network_mode: host
+networks:
+  front:
+    driver: bridge
+    ipam:
+      config:
+        - subnet: 172.28.0.0/16
+  back:
+    internal: true
+  locom:
+    external: true
+volumes:
+  node_modules:
+secrets:
+  token:
+    file: ./token.txt
+`
+
+func TestParse(t *testing.T) {
+	f, err := compose.Parse([]byte(fullCompose))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	web := f.Services["web"]
+	if web.Restart != "unless-stopped" {
+		t.Errorf("expected restart from the merged anchor, got %q", web.Restart)
+	}
+	if web.Build == nil || web.Build.Context != "./web" {
+		t.Errorf("expected build context ./web, got %+v", web.Build)
+	}
+	if web.Command.String != "npm start" || web.Command.List != nil {
+		t.Errorf("expected a shell command, got %+v", web.Command)
+	}
+	if v, ok := web.Environment.Get("NODE_ENV"); !ok || v != "development" || !web.Environment.List {
+		t.Errorf("unexpected environment %+v", web.Environment)
+	}
+	if len(web.DependsOn) != 2 || web.DependsOn[0].Service != "db" || web.DependsOn[0].Condition != "service_healthy" ||
+		web.DependsOn[1].Required == nil || *web.DependsOn[1].Required {
+		t.Errorf("unexpected depends_on %+v", web.DependsOn)
+	}
+	if got := strings.Join(web.Networks.Names(), ","); got != "front,back" || web.Networks[0].Aliases[0] != "shop" {
+		t.Errorf("unexpected networks %+v", web.Networks)
+	}
+	if len(web.Volumes) != 2 || web.Volumes[0].Type != "bind" || !web.Volumes[0].ReadOnly || web.Volumes[1].Source != "node_modules" {
+		t.Errorf("unexpected volumes %+v", web.Volumes)
+	}
+	if _, ok := web.Extensions["x-owner"]; !ok {
+		t.Errorf("expected x-owner in the service extensions, got %v", web.Extensions)
+	}
+	if _, ok := web.Extensions["deploy"]; !ok {
+		t.Errorf("expected deploy in the service extensions, got %v", web.Extensions)
+	}
+
+	wantPorts := []string{"8080:80", "127.0.0.1:8443:443", "[::1]:9000:9000/udp", "0.0.0.0:3000:3000"}
+	for i, p := range web.Ports {
+		if p.String() != wantPorts[i] {
+			t.Errorf("port %d: expected %q, got %q", i, wantPorts[i], p.String())
+		}
+	}
+
+	db := f.Services["db"]
+	if db.Healthcheck == nil || db.Healthcheck.Test.List[0] != "CMD-SHELL" || *db.Healthcheck.Retries != 5 {
+		t.Errorf("unexpected healthcheck %+v", db.Healthcheck)
+	}
+	if _, ok := db.Environment.Get("PGDATA"); ok {
+		t.Error("expected PGDATA without a value")
+	}
+	if v, _ := db.Build.Args.Get("PG_VERSION"); v != "16" {
+		t.Errorf("unexpected build args %+v", db.Build.Args)
+	}
+	if f.Services["cache"].NetworkMode != "host" {
+		t.Errorf("expected network_mode host, got %+v", f.Services["cache"])
+	}
+
+	if !f.Networks["locom"].External || f.Networks["front"].External || !f.Networks["back"].Internal {
+		t.Errorf("unexpected networks %+v", f.Networks)
+	}
+	if _, ok := f.Networks["front"].Extensions["ipam"]; !ok {
+		t.Error("expected ipam in the network extensions")
+	}
+	if _, ok := f.Extensions["x-defaults"]; !ok {
+		t.Errorf("expected x-defaults in the file extensions, got %v", f.Extensions)
+	}
+}
+
+func TestParse_InvalidVolume(t *testing.T) {
+	_, err := compose.Parse([]byte("services:\n  web:\n    volumes:\n      - \":/data\"\n"))
+	if err == nil || !strings.Contains(err.Error(), `invalid volume ":/data"`) {
+		t.Errorf("expected an invalid volume error, got %v", err)
+	}
+}
+
+func TestMarshal_RoundTrip(t *testing.T) {
+	f, err := compose.Parse([]byte(fullCompose))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	first, err := yaml.Marshal(f)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	again, err := compose.Parse(first)
+	if err != nil {
+		t.Fatalf("Parse of the written file failed: %v\n%s", err, first)
+	}
+	second, err := yaml.Marshal(again)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(first) != string(second) {
+		t.Errorf("writing is not stable:\n%s\n---\n%s", first, second)
+	}
+
+	// every value keeps the form it was written in
+	for _, want := range []string{
+		"build: ./web",
+		"command: npm start",
+		"- NODE_ENV=development\n",
+		"- DEBUG\n",
+		"entrypoint:\n            - docker-entrypoint.sh",
+		"POSTGRES_PASSWORD: secret",
+		"PGDATA:\n",
+		"- 8080:80\n",
+		"- '[::1]:9000:9000/udp'",
+		"mode: host",
+		"- ./src:/app/src:ro",
+		"nocopy: true",
+		"aliases:\n                    - shop",
+		"networks:\n            - back",
+		"- host.docker.internal:host-gateway",
+		"x-owner: team-shop",
+		"replicas: 2",
+		"x-defaults: &defaults",
+		"subnet: 172.28.0.0/16",
+		"file: ./token.txt",
+	} {
+		if !strings.Contains(string(first), want) {
+			t.Errorf("expected %q in:\n%s", want, first)
+		}
+	}
+}
+
+func TestFindFile(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := compose.FindFile(dir); err == nil {
+		t.Fatal("expected an error without compose file")
+	}
+	for _, name := range []string{"docker-compose.yml", "compose.yaml"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("services: {}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if found, err := compose.FindFile(dir); err != nil || filepath.Base(found) != "compose.yaml" {
+		t.Errorf("expected compose.yaml to take precedence, got %s (%v)", found, err)
+	}
+}
+
+func TestPort_Binds(t *testing.T) {
+	tests := []struct {
+		spec    string
+		address string
+		port    int
+		want    bool
+	}{
+		{"8080:80", "127.0.0.1", 8080, true},
+		{"8080:80", "127.0.0.1", 80, false},
+		{"127.0.0.1:8443:443", "127.0.0.1", 8443, true},
+		{"127.0.0.1:8443:443", "127.0.0.2", 8443, false},
+		{"0.0.0.0:3000:3000", "127.0.0.2", 3000, true},
+		{"[::1]:9000:9000/udp", "::1", 9000, false},
+		{"8000-8010:8000-8010", "127.0.0.1", 8005, true},
+		{"80", "127.0.0.1", 80, false},
+	}
+	for _, tt := range tests {
+		p, err := compose.ParsePort(tt.spec)
+		if err != nil {
+			t.Fatalf("ParsePort(%q) failed: %v", tt.spec, err)
+		}
+		if got := p.Binds(tt.address, tt.port); got != tt.want {
+			t.Errorf("%s binds %s:%d: expected %v, got %v", tt.spec, tt.address, tt.port, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,459 @@
+package compose
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The compose spec accepts several forms for many keys. The types below
+// read every form and write a value back in the form it was read in.
+
+// StringOrList is a value given as a string or as a list of strings, such as
+// command, entrypoint or a healthcheck test. The two are not equivalent:
+// docker runs a string through a shell.
+type StringOrList struct {
+	String string
+	List   []string
+}
+
+// ListOf builds the list form of a StringOrList.
+func ListOf(items ...string) StringOrList {
+	return StringOrList{List: append([]string{}, items...)}
+}
+
+func (v StringOrList) IsZero() bool {
+	return v.String == "" && v.List == nil
+}
+
+func (v *StringOrList) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.SequenceNode {
+		v.List = []string{}
+		return n.Decode(&v.List)
+	}
+	return n.Decode(&v.String)
+}
+
+func (v StringOrList) MarshalYAML() (any, error) {
+	if v.List != nil {
+		return v.List, nil
+	}
+	return v.String, nil
+}
+
+// Mapping is a set of variables written as a mapping or as a list of
+// KEY=VALUE strings, such as environment, labels or build args. Entries keep
+// their order. List items without "=" keep the whole item as key.
+type Mapping struct {
+	Entries []KeyValue
+	// List is set for the list form.
+	List bool
+}
+
+// KeyValue is an entry of a Mapping; a nil Value has no value at all,
+// e.g. an environment variable taken from the shell.
+type KeyValue struct {
+	Key   string
+	Value *string
+}
+
+// Get returns the value of key.
+func (m Mapping) Get(key string) (string, bool) {
+	for _, e := range m.Entries {
+		if e.Key == key && e.Value != nil {
+			return *e.Value, true
+		}
+	}
+	return "", false
+}
+
+// Set replaces the value of key, or appends it.
+func (m *Mapping) Set(key, value string) {
+	for i, e := range m.Entries {
+		if e.Key == key {
+			m.Entries[i].Value = &value
+			return
+		}
+	}
+	m.Entries = append(m.Entries, KeyValue{Key: key, Value: &value})
+}
+
+func (m Mapping) IsZero() bool {
+	return len(m.Entries) == 0
+}
+
+func (m *Mapping) UnmarshalYAML(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.SequenceNode:
+		m.List = true
+		for _, item := range n.Content {
+			key, value, ok := strings.Cut(item.Value, "=")
+			e := KeyValue{Key: key}
+			if ok {
+				e.Value = &value
+			}
+			m.Entries = append(m.Entries, e)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			e := KeyValue{Key: n.Content[i].Value}
+			if v := n.Content[i+1]; v.ShortTag() != "!!null" {
+				if v.Kind != yaml.ScalarNode {
+					return fmt.Errorf("line %d: %s: expected a value, got %s", v.Line, e.Key, kindName(v))
+				}
+				value := v.Value
+				e.Value = &value
+			}
+			m.Entries = append(m.Entries, e)
+		}
+	default:
+		return fmt.Errorf("line %d: expected a mapping or a list, got %s", n.Line, kindName(n))
+	}
+	return nil
+}
+
+func (m Mapping) MarshalYAML() (any, error) {
+	if m.List {
+		items := make([]string, len(m.Entries))
+		for i, e := range m.Entries {
+			items[i] = e.Key
+			if e.Value != nil {
+				items[i] += "=" + *e.Value
+			}
+		}
+		return items, nil
+	}
+	n := &yaml.Node{Kind: yaml.MappingNode}
+	for _, e := range m.Entries {
+		// values are strings to compose: "true" and port numbers stay quoted
+		value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}
+		if e.Value != nil {
+			value = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: *e.Value}
+		}
+		n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: e.Key}, value)
+	}
+	return n, nil
+}
+
+// Dependencies is depends_on, written as a list of services unless an entry
+// has settings.
+type Dependencies []Dependency
+
+func (d *Dependencies) UnmarshalYAML(n *yaml.Node) error {
+	return namedEntries(n, func(name string, value *yaml.Node) error {
+		dep := Dependency{Service: name}
+		if value != nil {
+			type plain Dependency
+			if err := value.Decode((*plain)(&dep)); err != nil {
+				return err
+			}
+			dep.Service = name
+		}
+		*d = append(*d, dep)
+		return nil
+	})
+}
+
+func (d Dependencies) MarshalYAML() (any, error) {
+	names := make([]string, len(d))
+	values := make([]any, len(d))
+	plain := true
+	for i, dep := range d {
+		names[i] = dep.Service
+		values[i] = dep
+		plain = plain && dep.Condition == "" && dep.Restart == nil && dep.Required == nil && len(dep.Extensions) == 0
+	}
+	return namedNode(names, values, plain)
+}
+
+// Attachments are the networks of a service, written as a list of names
+// unless a network has settings.
+type Attachments []Attachment
+
+// Networks builds the list form of Attachments.
+func Networks(names ...string) Attachments {
+	a := make(Attachments, len(names))
+	for i, name := range names {
+		a[i] = Attachment{Network: name}
+	}
+	return a
+}
+
+// Names lists the networks.
+func (a Attachments) Names() []string {
+	names := make([]string, len(a))
+	for i, att := range a {
+		names[i] = att.Network
+	}
+	return names
+}
+
+func (a *Attachments) UnmarshalYAML(n *yaml.Node) error {
+	return namedEntries(n, func(name string, value *yaml.Node) error {
+		att := Attachment{Network: name}
+		if value != nil {
+			type plain Attachment
+			if err := value.Decode((*plain)(&att)); err != nil {
+				return err
+			}
+			att.Network = name
+		}
+		*a = append(*a, att)
+		return nil
+	})
+}
+
+func (a Attachments) MarshalYAML() (any, error) {
+	names := make([]string, len(a))
+	values := make([]any, len(a))
+	plain := true
+	for i, att := range a {
+		names[i] = att.Network
+		values[i] = att
+		plain = plain && len(att.Aliases) == 0 && att.IPv4Address == "" && att.IPv6Address == "" && att.Priority == 0 && len(att.Extensions) == 0
+	}
+	return namedNode(names, values, plain)
+}
+
+// namedEntries reads a list of names or a mapping of names to settings;
+// value is nil for names without settings.
+func namedEntries(n *yaml.Node, entry func(name string, value *yaml.Node) error) error {
+	switch n.Kind {
+	case yaml.SequenceNode:
+		for _, item := range n.Content {
+			if err := entry(item.Value, nil); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			value := n.Content[i+1]
+			if value.ShortTag() == "!!null" {
+				value = nil
+			}
+			if err := entry(n.Content[i].Value, value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("line %d: expected a mapping or a list, got %s", n.Line, kindName(n))
+	}
+	return nil
+}
+
+func namedNode(names []string, values []any, plain bool) (any, error) {
+	if plain {
+		return names, nil
+	}
+	n := &yaml.Node{Kind: yaml.MappingNode}
+	for i, name := range names {
+		var value yaml.Node
+		if err := value.Encode(values[i]); err != nil {
+			return nil, err
+		}
+		n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}, &value)
+	}
+	return n, nil
+}
+
+// Port is an entry of a service's ports.
+type Port struct {
+	Target      int    `yaml:"target"`
+	Published   string `yaml:"published,omitempty"` // host port or range
+	HostIP      string `yaml:"host_ip,omitempty"`
+	Protocol    string `yaml:"protocol,omitempty"` // empty for tcp
+	Mode        string `yaml:"mode,omitempty"`
+	Name        string `yaml:"name,omitempty"`
+	AppProtocol string `yaml:"app_protocol,omitempty"`
+
+	Extensions Extensions `yaml:",inline"`
+
+	// Short is the port as read in short syntax, written back verbatim. A
+	// target range such as 8000-8010 only keeps its first port in Target.
+	Short string `yaml:"-"`
+}
+
+// ParsePort reads a port in short syntax: [[host_ip:]published:]target[/protocol].
+func ParsePort(s string) (Port, error) {
+	p := Port{Short: s}
+	spec := s
+	if before, proto, ok := strings.Cut(spec, "/"); ok {
+		spec, p.Protocol = before, proto
+	}
+	// the target is after the last colon; an IPv6 host IP is bracketed
+	target := spec
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		host := spec[:i]
+		target = spec[i+1:]
+		if j := strings.LastIndex(host, ":"); j >= 0 {
+			p.HostIP, p.Published = strings.Trim(host[:j], "[]"), host[j+1:]
+		} else {
+			p.Published = host
+		}
+	}
+	first, _, _ := strings.Cut(target, "-")
+	t, err := strconv.Atoi(first)
+	if err != nil {
+		return p, fmt.Errorf("invalid port %q", s)
+	}
+	p.Target = t
+	return p, nil
+}
+
+// String renders the port in short syntax.
+func (p Port) String() string {
+	if p.Short != "" {
+		return p.Short
+	}
+	s := strconv.Itoa(p.Target)
+	if p.Published != "" {
+		s = p.Published + ":" + s
+		if p.HostIP != "" {
+			s = net.JoinHostPort(p.HostIP, p.Published) + ":" + strconv.Itoa(p.Target)
+		}
+	}
+	if p.Protocol != "" && p.Protocol != "tcp" {
+		s += "/" + p.Protocol
+	}
+	return s
+}
+
+// Binds reports whether the port publishes a host port that would clash
+// with port on address; an unset or wildcard host IP binds every address.
+func (p Port) Binds(address string, port int) bool {
+	if p.Published == "" || (p.Protocol != "" && p.Protocol != "tcp") {
+		return false
+	}
+	if p.HostIP != "" && p.HostIP != "0.0.0.0" && p.HostIP != "::" && !sameIP(p.HostIP, address) {
+		return false
+	}
+	low, high, _ := strings.Cut(p.Published, "-")
+	if high == "" {
+		high = low
+	}
+	from, err1 := strconv.Atoi(low)
+	to, err2 := strconv.Atoi(high)
+	return err1 == nil && err2 == nil && from <= port && port <= to
+}
+
+func sameIP(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	return ipA != nil && ipA.Equal(ipB)
+}
+
+func (p *Port) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		parsed, err := ParsePort(n.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		*p = parsed
+		return nil
+	}
+	type plain Port
+	return n.Decode((*plain)(p))
+}
+
+func (p Port) MarshalYAML() (any, error) {
+	if p.Short != "" {
+		return p.Short, nil
+	}
+	if p.Mode == "" && p.Name == "" && p.AppProtocol == "" && len(p.Extensions) == 0 {
+		return p.String(), nil
+	}
+	type plain Port
+	return plain(p), nil
+}
+
+// VolumeMount is an entry of a service's volumes.
+type VolumeMount struct {
+	Type     string `yaml:"type,omitempty"`
+	Source   string `yaml:"source,omitempty"`
+	Target   string `yaml:"target"`
+	ReadOnly bool   `yaml:"read_only,omitempty"`
+
+	// Extensions keep the bind, volume and tmpfs settings.
+	Extensions Extensions `yaml:",inline"`
+
+	// Short is the mount as read in short syntax, written back verbatim.
+	Short string `yaml:"-"`
+}
+
+// ParseVolume reads a mount in short syntax: [source:]target[:mode].
+func ParseVolume(s string) VolumeMount {
+	v := VolumeMount{Short: s}
+	parts := strings.Split(s, ":")
+	if len(parts) > 1 && len(parts[0]) == 1 && strings.HasPrefix(parts[1], `\`) {
+		// a Windows drive letter, C:\data
+		parts = append([]string{parts[0] + ":" + parts[1]}, parts[2:]...)
+	}
+	switch len(parts) {
+	case 1:
+		v.Type, v.Target = "volume", parts[0]
+		return v
+	default:
+		v.Source, v.Target = parts[0], parts[1]
+	}
+	if len(parts) > 2 {
+		for _, opt := range strings.Split(parts[2], ",") {
+			v.ReadOnly = v.ReadOnly || opt == "ro"
+		}
+	}
+	v.Type = "volume"
+	if v.Source != "" && strings.ContainsAny(v.Source[:1], "./~$") || strings.Contains(v.Source, `\`) {
+		v.Type = "bind"
+	}
+	return v
+}
+
+func (v *VolumeMount) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		parsed := ParseVolume(n.Value)
+		if parsed.Source == "" && strings.Contains(n.Value, ":") {
+			return fmt.Errorf("line %d: invalid volume %q: empty source", n.Line, n.Value)
+		}
+		*v = parsed
+		return nil
+	}
+	type plain VolumeMount
+	return n.Decode((*plain)(v))
+}
+
+func (v VolumeMount) MarshalYAML() (any, error) {
+	if v.Short != "" {
+		return v.Short, nil
+	}
+	type plain VolumeMount
+	return plain(v), nil
+}
+
+func (b *Build) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		b.Context, b.short = n.Value, true
+		return nil
+	}
+	type plain Build
+	return n.Decode((*plain)(b))
+}
+
+func (b Build) MarshalYAML() (any, error) {
+	if b.short && b.Dockerfile == "" && b.Args.IsZero() && b.Target == "" && b.CacheFrom == nil && b.Labels.IsZero() && len(b.Extensions) == 0 {
+		return b.Context, nil
+	}
+	type plain Build
+	return plain(b), nil
+}
+
+func kindName(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	default:
+		return fmt.Sprintf("%q", n.Value)
+	}
+}
@@ -1,100 +1,438 @@
 package compose
 
 import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
 	"gopkg.in/yaml.v3"
+
+	"github.com/localcompose/locom/internal/config"
 )
 
-func GetTraefikCompose(networkName string) ComposeFile {
+// traefikRelease captures what differs between Traefik major versions:
+// v3 dropped multi-argument matchers such as Host(`a`, `b`).
+type traefikRelease struct {
+	version string
+	major   int
+}
+
+func newTraefikRelease(version string) (traefikRelease, error) {
+	supported := config.ProxyVersions["traefik"]
+	if !slices.Contains(supported, version) {
+		return traefikRelease{}, fmt.Errorf("unsupported Traefik version %q (supported: %s)", version, strings.Join(supported, ", "))
+	}
+	major, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	if err != nil {
+		return traefikRelease{}, fmt.Errorf("parsing Traefik version %q: %w", version, err)
+	}
+	return traefikRelease{version: version, major: major}, nil
+}
+
+func (r traefikRelease) image() string {
+	return "traefik:v" + r.version
+}
+
+// hostRule matches any of the hosts.
+func (r traefikRelease) hostRule(hosts ...string) string {
+	return r.matcher("Host", hosts...)
+}
+
+// hostSNIRule matches TLS connections to any of the hosts.
+func (r traefikRelease) hostSNIRule(hosts ...string) string {
+	return r.matcher("HostSNI", hosts...)
+}
+
+// appRule matches the requests an http app claims: to any of its hosts,
+// below its path, carrying its headers.
+func (r traefikRelease) appRule(hosts []string, app config.App) string {
+	host := r.hostRule(hosts...)
+	var terms []string
+	if app.Path != "" {
+		terms = append(terms, "PathPrefix(`"+app.Path+"`)")
+	}
+	headerMatcher := "Header"
+	if r.major < 3 {
+		headerMatcher = "Headers"
+	}
+	for _, key := range slices.Sorted(maps.Keys(app.Headers)) {
+		terms = append(terms, headerMatcher+"(`"+key+"`, `"+app.Headers[key]+"`)")
+	}
+	if len(terms) > 0 && strings.Contains(host, " || ") {
+		// && binds tighter than ||
+		host = "(" + host + ")"
+	}
+	return strings.Join(append([]string{host}, terms...), " && ")
+}
+
+// matcher matches any of the values with the named matcher.
+func (r traefikRelease) matcher(name string, values ...string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "`" + v + "`"
+	}
+	if r.major < 3 {
+		return name + "(" + strings.Join(quoted, ", ") + ")"
+	}
+	for i, q := range quoted {
+		quoted[i] = name + "(" + q + ")"
+	}
+	return strings.Join(quoted, " || ")
+}
+
+type traefikEngine struct{}
+
+func (traefikEngine) ProxyCompose(cfg *config.Config) (ComposeFile, error) {
+	return GetTraefikCompose(cfg)
+}
+
+// ProxyFiles returns no files: Traefik reads the routing of apps from the
+// labels of their containers.
+func (traefikEngine) ProxyFiles(cfg *config.Config) (map[string][]byte, error) {
+	return nil, nil
+}
+
+func (traefikEngine) AppCompose(cfg *config.Config, appName string) (ComposeFile, error) {
+	return GetTraefikAppCompose(cfg, appName)
+}
+
+// TraefikTLSFile is the file-provider configuration loading the certificate,
+// relative to the proxy's compose project.
+const TraefikTLSFile = "config/selfsigned.yml"
+
+func (traefikEngine) TLSFiles(cfg *config.Config) (map[string][]byte, error) {
+	if !cfg.Stage.Network.Proxy.TLS.HTTPS() {
+		return nil, nil
+	}
+	data, err := yaml.Marshal(Dynamic{TLS: TLS{Certificates: []Certificate{{
+		CertFile: CertsMount + "/" + FullchainFile,
+		KeyFile:  CertsMount + "/" + KeyFile,
+	}}}})
+	if err != nil {
+		return nil, fmt.Errorf("serializing Traefik TLS file: %w", err)
+	}
+	return map[string][]byte{TraefikTLSFile: data}, nil
+}
+
+// HealthCheck probes the ping endpoint, enabled by GetTraefikCompose on the
+// traefik entrypoint.
+func (traefikEngine) HealthCheck(cfg *config.Config) *Healthcheck {
+	return healthcheck("CMD", "traefik", "healthcheck", "--ping")
+}
+
+// GetTraefikCompose renders the proxy's compose file for the Traefik version
+// set in stage.network.proxy.type.
+func GetTraefikCompose(cfg *config.Config) (ComposeFile, error) {
+	proxy := cfg.Stage.Network.Proxy
+	if proxy.Type.Engine != "traefik" {
+		return ComposeFile{}, fmt.Errorf("unsupported proxy engine %q", proxy.Type.Engine)
+	}
+	release, err := newTraefikRelease(proxy.Type.Version)
+	if err != nil {
+		return ComposeFile{}, err
+	}
+	networkName := cfg.Stage.Network.Name
+	name := proxy.Name
+	host := cfg.ProxyHostname()
+	bind := cfg.Stage.Network.Bind
+
+	projectName, containerName := proxyNames(cfg)
+
+	mode := proxy.TLS
+	dashboard := proxy.Dashboard
+	command := []string{"--api.dashboard=true"}
+	if dashboard.InsecureEnabled() {
+		command = append(command, "--api.insecure=true")
+	}
+	command = append(command,
+		"--ping=true",
+		"--providers.docker=true",
+		"--providers.docker.exposedbydefault=false",
+		"--providers.docker.network="+networkName,
+	)
+	if cfg.Stage.Name != "" {
+		// the proxies of other stages on the host see the same containers
+		command = append(command, "--providers.docker.constraints=Label(`"+StageLabel+"`,`"+cfg.Stage.Name+"`)")
+	}
+	var ports []Port
+	if mode.HTTP() {
+		command = append(command, "--entrypoints.web.address=:80")
+		ports = append(ports, publish(bind.Address, bind.Ports.HTTP, 80))
+	}
+	if mode.HTTPS() {
+		command = append(command, "--entrypoints.websecure.address=:443")
+		ports = append(ports, publish(bind.Address, bind.Ports.HTTPS, 443))
+	}
+	for _, ep := range streamEntryPoints(cfg) {
+		address := ":" + strconv.Itoa(ep.port)
+		if ep.protocol == config.ProtocolUDP {
+			address += "/udp"
+		}
+		command = append(command, "--entrypoints."+ep.name+".address="+address)
+		port := publish(bind.Address, ep.port, ep.port)
+		if ep.protocol == config.ProtocolUDP {
+			port.Protocol = config.ProtocolUDP
+		}
+		ports = append(ports, port)
+	}
+	command = append(command,
+		"--providers.file.directory=/etc/traefik/dynamic",
+		"--providers.file.watch=true",
+	)
+	if dashboard.InsecureEnabled() {
+		ports = append(ports, publish(bind.Address, bind.Ports.Dashboard, 8080))
+	}
+
+	volumes := []VolumeMount{
+		ParseVolume("/var/run/docker.sock:/var/run/docker.sock:ro"),
+		ParseVolume("./config:/etc/traefik/dynamic"),
+	}
+	if mode.HTTPS() {
+		volumes = append(volumes, ParseVolume("./certs:"+CertsMount+":ro"))
+	}
+	if dashboard.User != "" {
+		volumes = append(volumes, ParseVolume(dashboardUsersFile+":"+dashboardUsersMount+":ro"))
+	}
+
 	composeFIle := ComposeFile{
-		Networks: map[string]ExternalNetwork{
+		Name: projectName,
+		Networks: map[string]Network{
 			networkName: {External: true},
 		},
 		Services: map[string]Service{
-			"traefik": {
-				Image:         "traefik:v2.10",
-				ContainerName: "traefik",
+			name: {
+				Image:         release.image(),
+				ContainerName: containerName,
 				Restart:       "unless-stopped",
-				Command: []string{
-					"--api.dashboard=true",
-					"--api.insecure=true",
-					"--providers.docker=true",
-					"--providers.docker.exposedbydefault=false",
-					"--entrypoints.web.address=:80",
-					"--entrypoints.websecure.address=:443",
-					"--providers.file.directory=/etc/traefik/dynamic",
-					"--providers.file.watch=true",
-				},
-				Ports: []string{
-					"80:80",
-					"443:443",
-					"8080:8080",
-				},
-				Volumes: []string{
-					"/var/run/docker.sock:/var/run/docker.sock:ro",
-					"./config:/etc/traefik/dynamic",
-					"./certs:/certs:ro",
-				},
-				Networks: []string{networkName},
+				Command:       ListOf(command...),
+				Healthcheck:   traefikEngine{}.HealthCheck(cfg),
+				Ports:         ports,
+				Volumes:       volumes,
+				Networks:      Networks(networkName),
+				Labels:        proxyLabels(name, release.hostRule(host), mode, dashboard, providerSettings(cfg)),
 			},
 		},
 	}
 
-	isHttps := true
-	s := composeFIle.Services["traefik"]
-
-	if isHttps {
-		httpRule := "Host(`proxy.locom.self`)"
-		s.LabelsNode = &yaml.Node{
-			Kind: yaml.MappingNode,
-			Content: []*yaml.Node{
-				// proxy
-				{Kind: yaml.ScalarNode, Value: "traefik.enable"},
-				{Kind: yaml.ScalarNode, Value: "true"},
-
-				// http
-				{Kind: yaml.ScalarNode, Value: "traefik.http.routers.traefik.rule"},
-				{Kind: yaml.ScalarNode, Value: httpRule},
-				{Kind: yaml.ScalarNode, Value: "traefik.http.routers.traefik.entrypoints"},
-				{Kind: yaml.ScalarNode, Value: "web"},
-
-				// redirect
-				{Kind: yaml.ScalarNode, Value: "traefik.http.routers.traefik.middlewares"},
-				{Kind: yaml.ScalarNode, Value: "redirect-to-https"},
-
-				// https
-				{Kind: yaml.ScalarNode, Value: "traefik.http.middlewares.redirect-to-https.redirectscheme.scheme"},
-				{Kind: yaml.ScalarNode, Value: "https"},
-
-				{Kind: yaml.ScalarNode, Value: "traefik.http.routers.traefik-secure.rule"},
-				{Kind: yaml.ScalarNode, Value: httpRule},
-
-				{Kind: yaml.ScalarNode, Value: "traefik.http.routers.traefik-secure.entrypoints"},
-				{Kind: yaml.ScalarNode, Value: "websecure"},
-				{Kind: yaml.ScalarNode, Value: "traefik.http.routers.traefik-secure.service"},
-				{Kind: yaml.ScalarNode, Value: "api@internal"},
-				{Kind: yaml.ScalarNode, Value: "traefik.http.routers.traefik-secure.tls"},
-				{Kind: yaml.ScalarNode, Value: "true"},
-			},
+	return composeFIle, nil
+}
+
+// proxyNames returns the compose project and container names of the proxy.
+// Several stages can run side by side on distinct bind addresses, so they
+// are named after the stage.
+func proxyNames(cfg *config.Config) (project, container string) {
+	name := cfg.Stage.Network.Proxy.Name
+	if stageName := cfg.Stage.Name; stageName != "" {
+		return stageName + "-proxy", stageName + "-" + name
+	}
+	return "", name
+}
+
+// dashboardUsersFile is the htpasswd file of the dashboard user, relative to
+// the proxy's compose project in the stage root.
+const (
+	dashboardUsersFile  = "../.locom/dashboard.htpasswd"
+	dashboardUsersMount = "/etc/traefik/dashboard.htpasswd"
+)
+
+// Traefik entrypoints and the middleware the proxy defines to redirect them.
+const (
+	webEntryPoint       = "web"
+	websecureEntryPoint = "websecure"
+	redirectMiddleware  = "redirect-to-https"
+)
+
+// proxyLabels routes the proxy hostname to the dashboard on the entrypoints
+// of the TLS mode: the http router either serves it or redirects to https.
+// Once the insecure API is off, the dashboard is kept to https wherever the
+// mode serves it.
+func proxyLabels(name, rule string, mode config.TLSMode, dashboard config.Dashboard, settings []string) Mapping {
+	var d Dynamic
+	var middlewares []string
+	if dashboard.User != "" {
+		auth := BasicAuthFile(name+"-auth", dashboardUsersMount)
+		d.Middlewares = append(d.Middlewares, auth)
+		middlewares = append(middlewares, auth.Name)
+	}
+	redirect := mode == config.TLSRedirect || (mode == config.TLSBoth && !dashboard.InsecureEnabled())
+	if redirect {
+		d.Middlewares = append(d.Middlewares, RedirectScheme(redirectMiddleware, "https"))
+	}
+	d.Routers = entryRouters(name, rule, "api@internal", mode, mode.HTTPS(), redirect, middlewares)
+
+	return labelMapping(d, settings...)
+}
+
+// entryRouters routes rule to service on the entrypoints of the TLS mode: on
+// websecure when https is served, and on web when http is, where the router
+// redirects to https instead of serving when redirect is set.
+func entryRouters(name, rule, service string, mode config.TLSMode, https, redirect bool, middlewares []string) []Router {
+	var routers []Router
+	switch {
+	case redirect:
+		routers = append(routers, Router{Name: name, Rule: rule, EntryPoints: []string{webEntryPoint}, Middlewares: []string{redirectMiddleware}})
+	case mode.HTTP():
+		routers = append(routers, Router{Name: name, Rule: rule, EntryPoints: []string{webEntryPoint}, Service: service, Middlewares: middlewares})
+	}
+	if https {
+		routers = append(routers, Router{Name: name + "-secure", Rule: rule, EntryPoints: []string{websecureEntryPoint}, Service: service, Middlewares: middlewares, TLS: &RouterTLS{}})
+	}
+	return routers
+}
+
+// streamEntryPoint is a tcp or udp entrypoint of the proxy, listening on the
+// same port in the container as on the bind address.
+type streamEntryPoint struct {
+	name     string
+	protocol string
+	port     int
+}
+
+// streamEntryPointName names the entrypoint of a tcp or udp app, e.g. tcp-5432.
+func streamEntryPointName(app config.App) string {
+	return app.Protocol + "-" + strconv.Itoa(app.EntryPoint)
+}
+
+// streamEntryPoints lists the entrypoints of the tcp and udp apps, tcp
+// first, by port.
+func streamEntryPoints(cfg *config.Config) []streamEntryPoint {
+	var eps []streamEntryPoint
+	for _, app := range cfg.Apps {
+		if app.HTTP() {
+			continue
 		}
-	} else {
-		s.LabelsNode = &yaml.Node{
-			Kind: yaml.MappingNode,
-			Content: []*yaml.Node{
-				// proxy
-				{Kind: yaml.ScalarNode, Value: "traefik.enable"},
-				{Kind: yaml.ScalarNode, Value: "true"},
-
-				// http
-				{Kind: yaml.ScalarNode, Value: "traefik.http.routers.traefik.rule"},
-				{Kind: yaml.ScalarNode, Value: "Host(`proxy.locom.self`)"},
-				{Kind: yaml.ScalarNode, Value: "traefik.http.routers.traefik.service"},
-				{Kind: yaml.ScalarNode, Value: "api@internal"},
-				{Kind: yaml.ScalarNode, Value: "traefik.http.routers.traefik.entrypoints"},
-				{Kind: yaml.ScalarNode, Value: "web"},
-			},
+		ep := streamEntryPoint{name: streamEntryPointName(app), protocol: app.Protocol, port: app.EntryPoint}
+		if !slices.Contains(eps, ep) {
+			eps = append(eps, ep)
 		}
 	}
-	composeFIle.Services["traefik"] = s
+	slices.SortFunc(eps, func(a, b streamEntryPoint) int {
+		return cmp.Or(strings.Compare(a.protocol, b.protocol), cmp.Compare(a.port, b.port))
+	})
+	return eps
+}
+
+// GetTraefikAppCompose renders the compose override that routes an app of
+// the stage through the proxy: it joins the app's service to the stage
+// network and labels it with a router for its hostnames.
+func GetTraefikAppCompose(cfg *config.Config, appName string) (ComposeFile, error) {
+	proxy := cfg.Stage.Network.Proxy
+	if proxy.Type.Engine != "traefik" {
+		return ComposeFile{}, fmt.Errorf("unsupported proxy engine %q", proxy.Type.Engine)
+	}
+	release, err := newTraefikRelease(proxy.Type.Version)
+	if err != nil {
+		return ComposeFile{}, err
+	}
+	app, ok := cfg.Apps[appName]
+	if !ok {
+		return ComposeFile{}, fmt.Errorf("unknown app %q", appName)
+	}
+	networkName := cfg.Stage.Network.Name
+	settings := append(providerSettings(cfg), "traefik.docker.network", networkName)
+
+	hosts := []string{cfg.Hostname(app.Host)}
+	for _, alias := range app.Aliases {
+		hosts = append(hosts, cfg.Hostname(alias))
+	}
+	var labels Mapping
+	switch app.Protocol {
+	case config.ProtocolTCP:
+		rule := release.hostSNIRule(hosts...)
+		if !app.TLSEnabled() {
+			rule = release.hostSNIRule("*")
+		}
+		labels = tcpLabels(appName, rule, app, settings)
+	case config.ProtocolUDP:
+		labels = udpLabels(appName, app, settings)
+	default:
+		labels = appLabels(appName, release.appRule(hosts, app), app, proxy.TLS, settings)
+	}
+
+	return ComposeFile{
+		Networks: map[string]Network{
+			networkName: {External: true},
+		},
+		Services: map[string]Service{
+			app.Service: {
+				Networks: Networks(networkName),
+				Labels:   labels,
+			},
+		},
+	}, nil
+}
+
+// appLabels routes an app like the proxy routes its dashboard: https apps get
+// a router on websecure, and on web one that redirects or serves depending on
+// the TLS mode; apps with tls disabled are served on web only. Apps with
+// strip set get their path removed by a stripPrefix middleware.
+func appLabels(name, rule string, app config.App, mode config.TLSMode, settings []string) Mapping {
+	https := app.TLSEnabled() && mode.HTTPS()
+	var middlewares []string
+	d := Dynamic{Services: []LoadBalancer{{Name: name, Port: app.Port}}}
+	if app.Strip {
+		strip := StripPrefix(name+"-strip", app.Path)
+		d.Middlewares = append(d.Middlewares, strip)
+		middlewares = append(middlewares, strip.Name)
+	}
+	d.Routers = entryRouters(name, rule, name, mode, https, https && mode == config.TLSRedirect, middlewares)
+	return labelMapping(d, settings...)
+}
+
+// tcpLabels routes the connections of a tcp app's entrypoint matching rule:
+// TLS connections by SNI, terminated with the stage certificate or passed
+// through, or any plain connection with HostSNI(`*`).
+func tcpLabels(name, rule string, app config.App, settings []string) Mapping {
+	router := TCPRouter{Name: name, Rule: rule, EntryPoints: []string{streamEntryPointName(app)}, Service: name}
+	if app.TLSEnabled() {
+		router.TLS = &TCPRouterTLS{Passthrough: app.Passthrough}
+	}
+	d := Dynamic{TCP: TCP{
+		Routers:  []TCPRouter{router},
+		Services: []LoadBalancer{{Name: name, Port: app.Port}},
+	}}
+	return labelMapping(d, settings...)
+}
+
+// udpLabels routes every datagram of a udp app's entrypoint to the app.
+func udpLabels(name string, app config.App, settings []string) Mapping {
+	d := Dynamic{UDP: UDP{
+		Routers:  []UDPRouter{{Name: name, EntryPoints: []string{streamEntryPointName(app)}, Service: name}},
+		Services: []LoadBalancer{{Name: name, Port: app.Port}},
+	}}
+	return labelMapping(d, settings...)
+}
+
+// StageLabel marks the containers of a stage; the proxy of the stage only
+// watches containers labelled with its name.
+const StageLabel = "locom.stage"
+
+// providerSettings lists the docker provider settings every container of
+// the stage carries, as key, value pairs.
+func providerSettings(cfg *config.Config) []string {
+	settings := []string{"traefik.enable", "true"}
+	if cfg.Stage.Name != "" {
+		settings = append(settings, StageLabel, cfg.Stage.Name)
+	}
+	return settings
+}
+
+// labelMapping lists the docker provider settings, given as key, value
+// pairs, before the labels of d.
+func labelMapping(d Dynamic, settings ...string) Mapping {
+	var m Mapping
+	for i := 0; i+1 < len(settings); i += 2 {
+		m.Set(settings[i], settings[i+1])
+	}
+	m.Entries = append(m.Entries, d.Labels().Entries...)
+	return m
+}
 
-	return composeFIle
+// publish maps a container port to a host port bound to one host address,
+// written as e.g. 127.0.0.1:80:80 or [::1]:80:80.
+func publish(address string, hostPort, containerPort int) Port {
+	return Port{HostIP: address, Published: strconv.Itoa(hostPort), Target: containerPort}
 }
@@ -0,0 +1,21 @@
+package compose
+
+import "testing"
+
+func TestTraefikRelease_HostRule(t *testing.T) {
+	v2, err := newTraefikRelease("2.11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v3, err := newTraefikRelease("3.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := v2.hostRule("a.locom.self", "b.locom.self"), "Host(`a.locom.self`, `b.locom.self`)"; got != want {
+		t.Errorf("v2: expected %q, got %q", want, got)
+	}
+	if got, want := v3.hostRule("a.locom.self", "b.locom.self"), "Host(`a.locom.self`) || Host(`b.locom.self`)"; got != want {
+		t.Errorf("v3: expected %q, got %q", want, got)
+	}
+}
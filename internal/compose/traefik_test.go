@@ -1,14 +1,31 @@
 package compose_test
 
 import (
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/localcompose/locom/internal/compose"
+	"github.com/localcompose/locom/internal/config"
 )
 
+func newConfig(networkName, version string) *config.Config {
+	var cfg config.Config
+	cfg.Stage.Network.Name = networkName
+	cfg.Stage.Network.DNS.Suffix = ".locom.self"
+	cfg.Stage.Network.Proxy.Name = "traefik"
+	cfg.Stage.Network.Proxy.Type.Engine = "traefik"
+	cfg.Stage.Network.Proxy.Type.Version = version
+	cfg.Stage.Network.Proxy.TLS = config.TLSRedirect
+	return &cfg
+}
+
 func TestGetTraefikCompose(t *testing.T) {
 	const networkName = "locom-net"
-	cfg := compose.GetTraefikCompose(networkName)
+	cfg, err := compose.GetTraefikCompose(newConfig(networkName, "2.10"))
+	if err != nil {
+		t.Fatalf("GetTraefikCompose failed: %v", err)
+	}
 
 	if len(cfg.Services) == 0 {
 		t.Fatal("expected at least one service defined")
@@ -33,3 +50,290 @@ func TestGetTraefikCompose(t *testing.T) {
 		t.Errorf("expected network %q to be external", networkName)
 	}
 }
+
+func TestGetTraefikCompose_Versions(t *testing.T) {
+	tests := []struct {
+		version string
+		image   string
+		rule    string
+	}{
+		{"2.10", "traefik:v2.10", "Host(`proxy.locom.self`)"},
+		{"3.1", "traefik:v3.1", "Host(`proxy.locom.self`)"},
+	}
+	for _, tt := range tests {
+		cfg, err := compose.GetTraefikCompose(newConfig("locom", tt.version))
+		if err != nil {
+			t.Fatalf("GetTraefikCompose(%s) failed: %v", tt.version, err)
+		}
+		svc := cfg.Services["traefik"]
+		if svc.Image != tt.image {
+			t.Errorf("version %s: expected image %q, got %q", tt.version, tt.image, svc.Image)
+		}
+		if got := label(svc, "traefik.http.routers.traefik.rule"); got != tt.rule {
+			t.Errorf("version %s: expected rule %q, got %q", tt.version, tt.rule, got)
+		}
+	}
+}
+
+func TestGetTraefikCompose_UnknownVersion(t *testing.T) {
+	_, err := compose.GetTraefikCompose(newConfig("locom", "1.7"))
+	if err == nil || !strings.Contains(err.Error(), `unsupported Traefik version "1.7"`) {
+		t.Fatalf("expected unsupported version error, got %v", err)
+	}
+}
+
+func TestGetTraefikCompose_SuffixAndName(t *testing.T) {
+	c := newConfig("locom", "2.10")
+	c.Stage.Network.DNS.Suffix = ".dev.example"
+	c.Stage.Network.Proxy.Name = "edge"
+
+	cfg, err := compose.GetTraefikCompose(c)
+	if err != nil {
+		t.Fatalf("GetTraefikCompose failed: %v", err)
+	}
+	svc, ok := cfg.Services["edge"]
+	if !ok {
+		t.Fatal("expected service named after the proxy")
+	}
+	if svc.ContainerName != "edge" {
+		t.Errorf("expected container name 'edge', got %q", svc.ContainerName)
+	}
+	if got, want := label(svc, "traefik.http.routers.edge-secure.rule"), "Host(`proxy.dev.example`)"; got != want {
+		t.Errorf("expected rule %q, got %q", want, got)
+	}
+}
+
+func TestGetTraefikCompose_BindAddress(t *testing.T) {
+	c := newConfig("locom", "2.10")
+	c.Stage.Name = "shop"
+	c.Stage.Network.Bind.Address = "127.0.0.2"
+	c.Stage.Network.Bind.Ports = config.Ports{HTTP: 8000, HTTPS: 8443, Dashboard: 9000}
+
+	cfg, err := compose.GetTraefikCompose(c)
+	if err != nil {
+		t.Fatalf("GetTraefikCompose failed: %v", err)
+	}
+	if cfg.Name != "shop-proxy" {
+		t.Errorf("expected compose project 'shop-proxy', got %q", cfg.Name)
+	}
+	svc := cfg.Services["traefik"]
+	if svc.ContainerName != "shop-traefik" {
+		t.Errorf("expected container name 'shop-traefik', got %q", svc.ContainerName)
+	}
+	want := []string{"127.0.0.2:8000:80", "127.0.0.2:8443:443", "127.0.0.2:9000:8080"}
+	if ports(svc) != strings.Join(want, ",") {
+		t.Errorf("expected ports %v, got %v", want, svc.Ports)
+	}
+
+	c.Stage.Network.Bind.Address = "::1"
+	cfg, err = compose.GetTraefikCompose(c)
+	if err != nil {
+		t.Fatalf("GetTraefikCompose failed: %v", err)
+	}
+	if got := cfg.Services["traefik"].Ports[0].String(); got != "[::1]:8000:80" {
+		t.Errorf("expected IPv6 port mapping, got %q", got)
+	}
+}
+
+func TestGetTraefikCompose_TLSModes(t *testing.T) {
+	tests := []struct {
+		mode       config.TLSMode
+		ports      []string
+		webService string
+		middleware string
+		secureTLS  string
+		certs      bool
+	}{
+		{config.TLSRedirect, []string{"127.0.0.1:80:80", "127.0.0.1:443:443", "127.0.0.1:8080:8080"}, "", "redirect-to-https", "true", true},
+		{config.TLSOnly, []string{"127.0.0.1:443:443", "127.0.0.1:8080:8080"}, "", "", "true", true},
+		{config.TLSOff, []string{"127.0.0.1:80:80", "127.0.0.1:8080:8080"}, "api@internal", "", "", false},
+		{config.TLSBoth, []string{"127.0.0.1:80:80", "127.0.0.1:443:443", "127.0.0.1:8080:8080"}, "api@internal", "", "true", true},
+	}
+	for _, tt := range tests {
+		c := newConfig("locom", "2.10")
+		c.Stage.Network.Bind = config.Bind{Address: "127.0.0.1", Ports: config.Ports{HTTP: 80, HTTPS: 443, Dashboard: 8080}}
+		c.Stage.Network.Proxy.TLS = tt.mode
+
+		cfg, err := compose.GetTraefikCompose(c)
+		if err != nil {
+			t.Fatalf("mode %s: GetTraefikCompose failed: %v", tt.mode, err)
+		}
+		svc := cfg.Services["traefik"]
+		if ports(svc) != strings.Join(tt.ports, ",") {
+			t.Errorf("mode %s: expected ports %v, got %v", tt.mode, tt.ports, svc.Ports)
+		}
+		if got := label(svc, "traefik.http.routers.traefik.service"); got != tt.webService {
+			t.Errorf("mode %s: expected http service %q, got %q", tt.mode, tt.webService, got)
+		}
+		if got := label(svc, "traefik.http.routers.traefik.middlewares"); got != tt.middleware {
+			t.Errorf("mode %s: expected http middlewares %q, got %q", tt.mode, tt.middleware, got)
+		}
+		if got := label(svc, "traefik.http.routers.traefik-secure.tls"); got != tt.secureTLS {
+			t.Errorf("mode %s: expected https router tls %q, got %q", tt.mode, tt.secureTLS, got)
+		}
+		hasCerts := slices.ContainsFunc(svc.Volumes, func(v compose.VolumeMount) bool { return v.Target == "/certs" })
+		if hasCerts != tt.certs {
+			t.Errorf("mode %s: expected certs volume %v, got %v", tt.mode, tt.certs, hasCerts)
+		}
+	}
+}
+
+func TestGetTraefikCompose_SecureDashboard(t *testing.T) {
+	c := newConfig("locom", "2.10")
+	c.Stage.Network.Bind = config.Bind{Address: "127.0.0.1", Ports: config.Ports{HTTP: 80, HTTPS: 443, Dashboard: 8080}}
+	c.Stage.Network.Proxy.TLS = config.TLSBoth
+	insecure := false
+	c.Stage.Network.Proxy.Dashboard = config.Dashboard{Insecure: &insecure, User: "admin"}
+
+	cfg, err := compose.GetTraefikCompose(c)
+	if err != nil {
+		t.Fatalf("GetTraefikCompose failed: %v", err)
+	}
+	svc := cfg.Services["traefik"]
+	if strings.Contains(strings.Join(svc.Command.List, " "), "--api.insecure") {
+		t.Errorf("expected no insecure API, got %v", svc.Command)
+	}
+	if want := "127.0.0.1:80:80,127.0.0.1:443:443"; ports(svc) != want {
+		t.Errorf("expected ports %s, got %v", want, svc.Ports)
+	}
+	if got := label(svc, "traefik.http.routers.traefik.middlewares"); got != "redirect-to-https" {
+		t.Errorf("expected the http router to redirect, got middlewares %q", got)
+	}
+	if got := label(svc, "traefik.http.routers.traefik-secure.middlewares"); got != "traefik-auth" {
+		t.Errorf("expected basic-auth on the https router, got %q", got)
+	}
+	if got := label(svc, "traefik.http.middlewares.traefik-auth.basicauth.usersfile"); got != "/etc/traefik/dashboard.htpasswd" {
+		t.Errorf("unexpected users file %q", got)
+	}
+}
+
+func TestGetTraefikAppCompose(t *testing.T) {
+	tests := []struct {
+		version    string
+		mode       config.TLSMode
+		tls        bool
+		rule       string
+		webService string
+		middleware string
+		secure     bool
+	}{
+		{"2.10", config.TLSRedirect, true, "Host(`shop.locom.self`, `www.locom.self`) && PathPrefix(`/api`)", "", "redirect-to-https", true},
+		{"3.1", config.TLSRedirect, false, "(Host(`shop.locom.self`) || Host(`www.locom.self`)) && PathPrefix(`/api`)", "shop", "", false},
+		{"2.10", config.TLSOnly, true, "Host(`shop.locom.self`, `www.locom.self`) && PathPrefix(`/api`)", "", "", true},
+		{"2.10", config.TLSBoth, true, "Host(`shop.locom.self`, `www.locom.self`) && PathPrefix(`/api`)", "shop", "", true},
+		{"2.10", config.TLSOff, true, "Host(`shop.locom.self`, `www.locom.self`) && PathPrefix(`/api`)", "shop", "", false},
+	}
+	for _, tt := range tests {
+		c := newConfig("locom", tt.version)
+		c.Stage.Network.Proxy.TLS = tt.mode
+		tls := tt.tls
+		c.Apps = map[string]config.App{
+			"shop": {Dir: "shop", Service: "web", Host: "shop", Port: 3000, Path: "/api", TLS: &tls, Aliases: []string{"www"}},
+		}
+
+		cfg, err := compose.GetTraefikAppCompose(c, "shop")
+		if err != nil {
+			t.Fatalf("GetTraefikAppCompose failed: %v", err)
+		}
+		if !cfg.Networks["locom"].External {
+			t.Errorf("expected the external stage network, got %v", cfg.Networks)
+		}
+		svc, ok := cfg.Services["web"]
+		if !ok {
+			t.Fatalf("expected the app's compose service, got %v", cfg.Services)
+		}
+		if strings.Join(svc.Networks.Names(), ",") != "locom" {
+			t.Errorf("expected the service on the stage network, got %v", svc.Networks)
+		}
+		if got := label(svc, "traefik.http.services.shop.loadbalancer.server.port"); got != "3000" {
+			t.Errorf("expected port label 3000, got %q", got)
+		}
+		router := "traefik.http.routers.shop"
+		if tt.secure {
+			router += "-secure"
+		}
+		if got := label(svc, router+".rule"); got != tt.rule {
+			t.Errorf("%s %s: expected rule %q, got %q", tt.version, tt.mode, tt.rule, got)
+		}
+		if got := label(svc, "traefik.http.routers.shop.service"); got != tt.webService {
+			t.Errorf("%s: expected http service %q, got %q", tt.mode, tt.webService, got)
+		}
+		if got := label(svc, "traefik.http.routers.shop.middlewares"); got != tt.middleware {
+			t.Errorf("%s: expected http middlewares %q, got %q", tt.mode, tt.middleware, got)
+		}
+		if got := label(svc, "traefik.http.routers.shop-secure.tls") == "true"; got != tt.secure {
+			t.Errorf("%s: expected https router %v, got %v", tt.mode, tt.secure, got)
+		}
+	}
+
+	if _, err := compose.GetTraefikAppCompose(newConfig("locom", "2.10"), "nope"); err == nil {
+		t.Error("expected an error for an unknown app")
+	}
+}
+
+// TestGetTraefikCompose_Stages renders two stages sharing a host and a
+// network name, with the same app, and checks that each proxy only watches
+// the containers of its own stage, whose routers then cannot collide.
+func TestGetTraefikCompose_Stages(t *testing.T) {
+	var containers []compose.Service
+	proxies := map[string]compose.Service{}
+	for _, stage := range []string{"shop", "blog"} {
+		c := newConfig("locom", "3.1")
+		c.Stage.Name = stage
+		c.Apps = map[string]config.App{"web": {Service: "web", Host: stage, Port: 80}}
+		proxy, err := compose.GetTraefikCompose(c)
+		if err != nil {
+			t.Fatalf("GetTraefikCompose failed: %v", err)
+		}
+		app, err := compose.GetTraefikAppCompose(c, "web")
+		if err != nil {
+			t.Fatalf("GetTraefikAppCompose failed: %v", err)
+		}
+		proxies[stage] = proxy.Services["traefik"]
+		containers = append(containers, proxy.Services["traefik"], app.Services["web"])
+	}
+
+	for stage, proxy := range proxies {
+		constraint := "--providers.docker.constraints=Label(`" + compose.StageLabel + "`,`" + stage + "`)"
+		if !slices.Contains(proxy.Command.List, constraint) {
+			t.Fatalf("%s: expected %s, got %v", stage, constraint, proxy.Command.List)
+		}
+		rules := map[string]string{}
+		watched := 0
+		for _, svc := range containers {
+			if label(svc, compose.StageLabel) != stage {
+				continue
+			}
+			watched++
+			for _, e := range svc.Labels.Entries {
+				router, ok := strings.CutPrefix(e.Key, "traefik.http.routers.")
+				if !ok || !strings.HasSuffix(router, ".rule") {
+					continue
+				}
+				if other, ok := rules[router]; ok && other != *e.Value {
+					t.Errorf("%s: router %s has the rules %s and %s", stage, router, other, *e.Value)
+				}
+				rules[router] = *e.Value
+			}
+		}
+		if watched != 2 {
+			t.Errorf("%s: expected the proxy to watch its own 2 containers, got %d", stage, watched)
+		}
+		if want := "Host(`" + stage + ".locom.self`)"; rules["web.rule"] != want {
+			t.Errorf("%s: expected the web router to match %s, got %q", stage, want, rules["web.rule"])
+		}
+	}
+}
+
+func label(svc compose.Service, key string) string {
+	value, _ := svc.Labels.Get(key)
+	return value
+}
+
+func ports(svc compose.Service) string {
+	s := make([]string, len(svc.Ports))
+	for i, p := range svc.Ports {
+		s[i] = p.String()
+	}
+	return strings.Join(s, ",")
+}
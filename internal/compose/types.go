@@ -1,30 +1,172 @@
 package compose
 
-import "gopkg.in/yaml.v3"
+import (
+	"gopkg.in/yaml.v3"
+)
 
-// ComposeFile represents a Docker Compose file
+// ComposeFile represents a Docker Compose file. Keys locom does not model,
+// such as x- extensions or include, are kept in Extensions and written back
+// as they were read, so a file can be loaded, changed and saved without
+// losing anything.
 type ComposeFile struct {
-	Version  string                     `yaml:"version,omitempty"`
-	Networks map[string]ExternalNetwork `yaml:"networks"`
-	Services map[string]Service         `yaml:"services"`
+	Version  string              `yaml:"version,omitempty"`
+	Name     string              `yaml:"name,omitempty"`
+	Services map[string]Service  `yaml:"services"`
+	Networks map[string]Network  `yaml:"networks,omitempty"`
+	Volumes  map[string]Volume   `yaml:"volumes,omitempty"`
+	Secrets  map[string]Resource `yaml:"secrets,omitempty"`
+	Configs  map[string]Resource `yaml:"configs,omitempty"`
+
+	Extensions Extensions `yaml:",inline"`
 }
 
+// Extensions holds the keys of a compose mapping that have no field, x- keys
+// in particular, as their original YAML nodes.
+type Extensions map[string]yaml.Node
+
 // Service represents a single service in Compose
 type Service struct {
-	Image         string   `yaml:"image,omitempty"`
-	ContainerName string   `yaml:"container_name,omitempty"`
-	Restart       string   `yaml:"restart,omitempty"`
-	Command       []string `yaml:"command,omitempty"`
-	Ports         []string `yaml:"ports,omitempty"`
-	Volumes       []string `yaml:"volumes,omitempty"`
-	Networks      []string `yaml:"networks,omitempty"`
-
-	// Use either Labels (unordered map) or LabelsNode (ordered with optional anchors)
-	// Labels     map[string]string `yaml:"labels,omitempty"`
-	LabelsNode *yaml.Node `yaml:"labels,omitempty"`
-}
-
-// ExternalNetwork represents an external network
-type ExternalNetwork struct {
-	External bool `yaml:"external"`
+	Image         string        `yaml:"image,omitempty"`
+	Build         *Build        `yaml:"build,omitempty"`
+	ContainerName string        `yaml:"container_name,omitempty"`
+	Hostname      string        `yaml:"hostname,omitempty"`
+	Restart       string        `yaml:"restart,omitempty"`
+	Profiles      []string      `yaml:"profiles,omitempty"`
+	Entrypoint    StringOrList  `yaml:"entrypoint,omitempty"`
+	Command       StringOrList  `yaml:"command,omitempty"`
+	WorkingDir    string        `yaml:"working_dir,omitempty"`
+	User          string        `yaml:"user,omitempty"`
+	Environment   Mapping       `yaml:"environment,omitempty"`
+	DependsOn     Dependencies  `yaml:"depends_on,omitempty"`
+	Healthcheck   *Healthcheck  `yaml:"healthcheck,omitempty"`
+	Ports         []Port        `yaml:"ports,omitempty"`
+	Expose        []string      `yaml:"expose,omitempty"`
+	Volumes       []VolumeMount `yaml:"volumes,omitempty"`
+	NetworkMode   string        `yaml:"network_mode,omitempty"`
+	Networks      Attachments   `yaml:"networks,omitempty"`
+	ExtraHosts    Mapping       `yaml:"extra_hosts,omitempty"`
+	Labels        Mapping       `yaml:"labels,omitempty"`
+
+	// PortsMerge tags Ports in an override file so that they replace the
+	// ports of the overridden file instead of adding to them: ResetTag
+	// drops them all, OverrideTag replaces them with Ports.
+	PortsMerge string `yaml:"-"`
+
+	Extensions Extensions `yaml:",inline"`
+}
+
+// Compose merge tags for override files.
+const (
+	ResetTag    = "!reset"
+	OverrideTag = "!override"
+)
+
+// MarshalYAML applies PortsMerge to the ports of the encoded service.
+func (s Service) MarshalYAML() (any, error) {
+	type plain Service
+	var n yaml.Node
+	if err := n.Encode(plain(s)); err != nil {
+		return nil, err
+	}
+	if s.PortsMerge == "" {
+		return &n, nil
+	}
+	ports := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == "ports" {
+			ports = n.Content[i+1]
+		}
+	}
+	if len(ports.Content) == 0 {
+		// an empty list, written as [] next to its tag
+		n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "ports"}, ports)
+	}
+	ports.Tag = s.PortsMerge
+	return &n, nil
+}
+
+// Build is the build section of a service, read from either a context path
+// or a mapping.
+type Build struct {
+	Context    string   `yaml:"context,omitempty"`
+	Dockerfile string   `yaml:"dockerfile,omitempty"`
+	Args       Mapping  `yaml:"args,omitempty"`
+	Target     string   `yaml:"target,omitempty"`
+	CacheFrom  []string `yaml:"cache_from,omitempty"`
+	Labels     Mapping  `yaml:"labels,omitempty"`
+
+	Extensions Extensions `yaml:",inline"`
+
+	// short is set when the section was read as a plain context path.
+	short bool
+}
+
+// Healthcheck is the healthcheck section of a service.
+type Healthcheck struct {
+	Test          StringOrList `yaml:"test,omitempty"`
+	Interval      string       `yaml:"interval,omitempty"`
+	Timeout       string       `yaml:"timeout,omitempty"`
+	Retries       *int         `yaml:"retries,omitempty"`
+	StartPeriod   string       `yaml:"start_period,omitempty"`
+	StartInterval string       `yaml:"start_interval,omitempty"`
+	Disable       bool         `yaml:"disable,omitempty"`
+
+	Extensions Extensions `yaml:",inline"`
+}
+
+// Dependency is one entry of depends_on.
+type Dependency struct {
+	Service   string `yaml:"-"`
+	Condition string `yaml:"condition,omitempty"`
+	Restart   *bool  `yaml:"restart,omitempty"`
+	Required  *bool  `yaml:"required,omitempty"`
+
+	Extensions Extensions `yaml:",inline"`
+}
+
+// Attachment is a network a service joins, with its optional settings.
+type Attachment struct {
+	Network     string   `yaml:"-"`
+	Aliases     []string `yaml:"aliases,omitempty"`
+	IPv4Address string   `yaml:"ipv4_address,omitempty"`
+	IPv6Address string   `yaml:"ipv6_address,omitempty"`
+	Priority    int      `yaml:"priority,omitempty"`
+
+	Extensions Extensions `yaml:",inline"`
+}
+
+// Network is a top-level network. Stage networks are declared External.
+type Network struct {
+	Name       string  `yaml:"name,omitempty"`
+	Driver     string  `yaml:"driver,omitempty"`
+	DriverOpts Mapping `yaml:"driver_opts,omitempty"`
+	External   bool    `yaml:"external,omitempty"`
+	Internal   bool    `yaml:"internal,omitempty"`
+	Attachable bool    `yaml:"attachable,omitempty"`
+	EnableIPv6 *bool   `yaml:"enable_ipv6,omitempty"`
+	Labels     Mapping `yaml:"labels,omitempty"`
+
+	Extensions Extensions `yaml:",inline"`
+}
+
+// Volume is a top-level named volume.
+type Volume struct {
+	Name       string  `yaml:"name,omitempty"`
+	Driver     string  `yaml:"driver,omitempty"`
+	DriverOpts Mapping `yaml:"driver_opts,omitempty"`
+	External   bool    `yaml:"external,omitempty"`
+	Labels     Mapping `yaml:"labels,omitempty"`
+
+	Extensions Extensions `yaml:",inline"`
+}
+
+// Resource is a top-level secret or config.
+type Resource struct {
+	Name        string `yaml:"name,omitempty"`
+	File        string `yaml:"file,omitempty"`
+	Environment string `yaml:"environment,omitempty"`
+	Content     string `yaml:"content,omitempty"`
+	External    bool   `yaml:"external,omitempty"`
+
+	Extensions Extensions `yaml:",inline"`
 }
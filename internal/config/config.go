@@ -1,21 +1,174 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
+// LoadConfig loads a locom.yml with the profiles listed in LOCOM_PROFILE,
+// read from the environment or the .env file next to it.
 func LoadConfig(path string) (*Config, error) {
+	profiles, err := EnvProfiles(path)
+	if err != nil {
+		return nil, err
+	}
+	return Load(path, profiles...)
+}
+
+// EnvProfiles returns the profiles listed in LOCOM_PROFILE, read from the
+// environment or the .env file next to the locom.yml at path.
+func EnvProfiles(path string) ([]string, error) {
+	lookup, err := envLookup(filepath.Join(filepath.Dir(path), DotEnvFile))
+	if err != nil {
+		return nil, err
+	}
+	list, _ := lookup(ProfileEnv)
+	profiles, err := ParseProfiles(list)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ProfileEnv, err)
+	}
+	return profiles, nil
+}
+
+// Load reads a locom.yml, merges the overlay file of each profile on top of
+// it in order, then interpolates, decodes and validates the result.
+// Variables are taken from the environment and the .env file next to it.
+// Problems in the files themselves are returned together as Errors, each
+// carrying its file and position.
+func Load(path string, profiles ...string) (*Config, error) {
+	lookup, err := envLookup(filepath.Join(filepath.Dir(path), DotEnvFile))
+	if err != nil {
+		return nil, err
+	}
+	return load(path, profiles, lookup)
+}
+
+func load(path string, profiles []string, lookup lookupFunc) (*Config, error) {
+	doc, err := parseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return loadDoc(path, doc, profiles, lookup)
+}
+
+// loadDoc finishes loading the parsed base file at path.
+func loadDoc(path string, doc *yaml.Node, profiles []string, lookup lookupFunc) (*Config, error) {
+	if err := migrateVersion(path, doc); err != nil {
+		return nil, err
+	}
+
+	origins := map[*yaml.Node]string{}
+	for _, profile := range profiles {
+		overlayPath := ProfilePath(path, profile)
+		overlay, err := parseFile(overlayPath)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("profile %q: %s not found", profile, overlayPath)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := migrateVersion(overlayPath, overlay); err != nil {
+			return nil, err
+		}
+		doc = merge(doc, overlay, overlayPath, origins)
+	}
+
+	var errs Errors
+	interpolateNode(doc, lookup, "", &errs)
+	if len(errs) > 0 {
+		return nil, errs.withFile(path, origins)
+	}
+
+	cfg, err := decode(doc, defaultStageName(path))
+	if err != nil {
+		if errors.As(err, &errs) {
+			return nil, errs.withFile(path, origins)
+		}
+		return nil, fmt.Errorf("unmarshalling yaml: %w", err)
+	}
+	return cfg, nil
+}
+
+// defaultStageName derives a compose project name from the stage folder,
+// the parent of the folder holding locom.yml.
+func defaultStageName(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	name := strings.ToLower(filepath.Base(filepath.Dir(filepath.Dir(abs))))
+	name = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			return r
+		}
+		return '-'
+	}, name)
+	return strings.TrimLeft(name, "_-")
+}
+
+// migrateVersion upgrades a parsed file in memory to CurrentVersion;
+// 'locom config migrate' makes the upgrade permanent.
+func migrateVersion(path string, doc *yaml.Node) error {
+	if _, err := migrateDoc(doc); err != nil {
+		var e *Error
+		if errors.As(err, &e) {
+			return Errors{e}.withFile(path, nil)
+		}
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func parseFile(path string) (*yaml.Node, error) {
 	raw, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("reading config file %q: %w", path, err)
 	}
+	return parseData(path, raw)
+}
 
-	var cfg Config
-	if err := yaml.Unmarshal(raw, &cfg); err != nil {
-		return nil, fmt.Errorf("unmarshalling yaml: %w", err)
+func parseData(path string, raw []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, Errors{syntaxError(err)}.withFile(path, nil)
+	}
+	return &doc, nil
+}
+
+var yamlLineRe = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// syntaxError lifts the line number out of a yaml.v3 parser message.
+func syntaxError(err error) *Error {
+	if m := yamlLineRe.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return &Error{Line: line, Column: 1, Msg: m[2]}
+	}
+	return &Error{Msg: err.Error()}
+}
+
+// Marshal renders a config as YAML, e.g. to show the result of interpolation and defaults.
+func Marshal(cfg *Config) ([]byte, error) {
+	return encode(cfg)
+}
+
+// encode writes YAML with the 2-space indentation locom.yml uses.
+func encode(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
 	}
-	return &cfg, nil
+	return buf.Bytes(), nil
 }
@@ -33,3 +33,125 @@ apps: {}
 	require.NoError(t, err)
 	require.Equal(t, "testnet", cfg.Stage.Network.Name)
 }
+
+func TestLoadConfig_Apps(t *testing.T) {
+	yamlData := `
+stage:
+  network:
+    name: testnet
+apps:
+  web:
+    port: 8080
+    tls: false
+    aliases: [www]
+  api:
+    dir: backend
+    service: server
+    host: backend-api
+    port: 3000
+    path: /api
+`
+
+	tmpFile := filepath.Join(t.TempDir(), "locom.yml")
+	require.NoError(t, os.WriteFile(tmpFile, []byte(yamlData), 0644))
+
+	cfg, err := config.LoadConfig(tmpFile)
+	require.NoError(t, err)
+	require.Len(t, cfg.Apps, 2)
+
+	web := cfg.Apps["web"]
+	require.Equal(t, "web", web.Dir)
+	require.Equal(t, "web", web.Service)
+	require.Equal(t, "web", web.Host)
+	require.Equal(t, 8080, web.Port)
+	require.False(t, web.TLSEnabled())
+	require.Equal(t, []string{"www"}, web.Aliases)
+
+	api := cfg.Apps["api"]
+	require.Equal(t, "backend", api.Dir)
+	require.Equal(t, "server", api.Service)
+	require.Equal(t, "backend-api", api.Host)
+	require.Equal(t, "/api", api.Path)
+	require.True(t, api.TLSEnabled())
+}
+
+func TestLoadConfig_StrictFields(t *testing.T) {
+	yamlData := `stage:
+  network:
+    name: testnet
+    bnid:
+      address: 127.0.0.1
+apps:
+  web:
+    prot: 8080
+    tls: maybe
+    aliases: www
+`
+
+	tmpFile := filepath.Join(t.TempDir(), "locom.yml")
+	require.NoError(t, os.WriteFile(tmpFile, []byte(yamlData), 0644))
+
+	_, err := config.LoadConfig(tmpFile)
+	require.Error(t, err)
+
+	var errs config.Errors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 4)
+	require.Equal(t, tmpFile, errs[0].File)
+	require.Equal(t, 4, errs[0].Line)
+	require.Equal(t, 5, errs[0].Column)
+	require.Equal(t, "stage.network", errs[0].Path)
+	require.Contains(t, errs[0].Msg, `unknown field "bnid"`)
+	require.Equal(t, 8, errs[1].Line)
+	require.Equal(t, 5, errs[1].Column)
+	require.Contains(t, errs[1].Msg, `unknown field "prot"`)
+	require.Equal(t, "apps.web.tls", errs[2].Path)
+	require.Equal(t, 10, errs[3].Line)
+	require.Equal(t, 14, errs[3].Column)
+	require.Equal(t, "apps.web.aliases", errs[3].Path)
+}
+
+func TestLoadConfig_Interpolation(t *testing.T) {
+	yamlData := `
+stage:
+  network:
+    name: ${NETWORK:-locom}
+    bind:
+      address: ${BIND_ADDRESS}
+    dns:
+      suffix: ${SUFFIX:-.locom.self}
+apps:
+  web:
+    port: ${WEB_PORT}
+`
+
+	dir := t.TempDir()
+	tmpFile := filepath.Join(dir, "locom.yml")
+	require.NoError(t, os.WriteFile(tmpFile, []byte(yamlData), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".env"), []byte("BIND_ADDRESS=127.0.0.2\nWEB_PORT=3000\nSUFFIX=.env.self\n"), 0644))
+	t.Setenv("SUFFIX", ".dev.self")
+
+	cfg, err := config.LoadConfig(tmpFile)
+	require.NoError(t, err)
+	require.Equal(t, "locom", cfg.Stage.Network.Name)
+	require.Equal(t, "127.0.0.2", cfg.Stage.Network.Bind.Address)
+	require.Equal(t, ".dev.self", cfg.Stage.Network.DNS.Suffix, "environment overrides .env")
+	require.Equal(t, 3000, cfg.Apps["web"].Port)
+}
+
+func TestLoadConfig_InterpolationRequired(t *testing.T) {
+	yamlData := `stage:
+  network:
+    name: ${NETWORK:?must be set in .locom/.env}
+`
+
+	tmpFile := filepath.Join(t.TempDir(), "locom.yml")
+	require.NoError(t, os.WriteFile(tmpFile, []byte(yamlData), 0644))
+
+	_, err := config.LoadConfig(tmpFile)
+	var errs config.Errors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 1)
+	require.Equal(t, 3, errs[0].Line)
+	require.Contains(t, errs[0].Msg, "NETWORK must be set")
+}
@@ -0,0 +1,214 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// decode checks the document against the Config types before decoding it,
+// so unknown keys and mistyped values are all reported with their position
+// instead of yaml.v3 stopping at the first one.
+func decode(doc *yaml.Node, stageName string) (*Config, error) {
+	cfg := Config{Version: CurrentVersion}
+	root := documentRoot(doc)
+	if root == nil || root.Kind == 0 {
+		// an empty file still gets defaults and validation
+		root = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: 1, Column: 1}
+	}
+
+	var errs Errors
+	checkNode(root, reflect.TypeOf(cfg), "", &errs)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	if err := root.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	setDefault(&cfg.Stage.Name, stageName)
+	cfg.applyDefaults()
+
+	if errs := validate(&cfg, root); len(errs) > 0 {
+		return nil, errs
+	}
+	return &cfg, nil
+}
+
+func (cfg *Config) applyDefaults() {
+	n := &cfg.Stage.Network
+	setDefault(&n.Bind.Address, DefaultBindAddress)
+	setDefaultInt(&n.Bind.Ports.HTTP, DefaultHTTPPort)
+	setDefaultInt(&n.Bind.Ports.HTTPS, DefaultHTTPSPort)
+	setDefaultInt(&n.Bind.Ports.Dashboard, DefaultDashboardPort)
+	setDefault(&n.DNS.Suffix, DefaultDNSSuffix)
+	setDefault(&n.Proxy.Type.Engine, DefaultProxyEngine)
+	setDefault(&n.Proxy.Type.Version, DefaultProxyVersions[n.Proxy.Type.Engine])
+	setDefault(&n.Proxy.Name, n.Proxy.Type.Engine)
+	if n.Proxy.TLS == "" {
+		n.Proxy.TLS = DefaultTLSMode
+	}
+	if n.Proxy.Dashboard.Insecure == nil {
+		insecure := true
+		n.Proxy.Dashboard.Insecure = &insecure
+	}
+
+	for name, app := range cfg.Apps {
+		if app.Dir == "" {
+			app.Dir = name
+		}
+		if app.Service == "" {
+			app.Service = name
+		}
+		if app.Host == "" {
+			app.Host = name
+		}
+		if app.TLS == nil {
+			enabled := true
+			app.TLS = &enabled
+		}
+		setDefault(&app.Protocol, ProtocolHTTP)
+		cfg.Apps[name] = app
+	}
+}
+
+func setDefault(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+func setDefaultInt(field *int, value int) {
+	if *field == 0 {
+		*field = value
+	}
+}
+
+func checkNode(n *yaml.Node, t reflect.Type, path string, errs *Errors) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.ShortTag() == "!!null" {
+		return
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if !expectKind(n, yaml.MappingNode, "a mapping", path, errs) {
+			return
+		}
+		checkDuplicateKeys(n, path, errs)
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, val := n.Content[i], n.Content[i+1]
+			f, ok := fields[key.Value]
+			if !ok {
+				*errs = append(*errs, nodeError(key, path,
+					fmt.Sprintf("unknown field %q (expected one of: %s)", key.Value, strings.Join(sortedKeys(fields), ", "))))
+				continue
+			}
+			checkNode(val, f.Type, joinPath(path, key.Value), errs)
+		}
+	case reflect.Map:
+		if !expectKind(n, yaml.MappingNode, "a mapping", path, errs) {
+			return
+		}
+		checkDuplicateKeys(n, path, errs)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			checkNode(n.Content[i+1], t.Elem(), joinPath(path, n.Content[i].Value), errs)
+		}
+	case reflect.Slice:
+		if !expectKind(n, yaml.SequenceNode, "a list", path, errs) {
+			return
+		}
+		for i, item := range n.Content {
+			checkNode(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case reflect.String:
+		expectKind(n, yaml.ScalarNode, "a string", path, errs)
+	case reflect.Bool:
+		if expectKind(n, yaml.ScalarNode, "a boolean", path, errs) && n.ShortTag() != "!!bool" {
+			*errs = append(*errs, nodeError(n, path, fmt.Sprintf("expected a boolean (true or false), got %q", n.Value)))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if expectKind(n, yaml.ScalarNode, "an integer", path, errs) && n.ShortTag() != "!!int" {
+			*errs = append(*errs, nodeError(n, path, fmt.Sprintf("expected an integer, got %q", n.Value)))
+		}
+	}
+}
+
+// checkDuplicateKeys reports keys defined twice in one mapping, which yaml.v3
+// would otherwise only report one at a time while decoding.
+func checkDuplicateKeys(n *yaml.Node, path string, errs *Errors) {
+	seen := map[string]*yaml.Node{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key := n.Content[i]
+		if first, ok := seen[key.Value]; ok {
+			*errs = append(*errs, nodeError(key, path, fmt.Sprintf("duplicate key %q (first defined at line %d)", key.Value, first.Line)))
+			continue
+		}
+		seen[key.Value] = key
+	}
+}
+
+func expectKind(n *yaml.Node, kind yaml.Kind, what, path string, errs *Errors) bool {
+	if n.Kind == kind {
+		return true
+	}
+	*errs = append(*errs, nodeError(n, path, fmt.Sprintf("expected %s, got %s", what, describeNode(n))))
+	return false
+}
+
+func describeNode(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	default:
+		return fmt.Sprintf("%q", n.Value)
+	}
+}
+
+// yamlFields maps the yaml keys of a struct type to its fields.
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
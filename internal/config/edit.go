@@ -0,0 +1,350 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/localcompose/locom/internal/diff"
+)
+
+// Get returns the effective value at a dotted key path such as
+// stage.network.bind.address, after the profiles, interpolation and
+// defaults. Scalars are returned as-is, mappings and lists as YAML.
+func Get(path, key string, profiles ...string) (string, error) {
+	keys := splitPath(key)
+	if _, err := typeAt(keys); err != nil {
+		return "", err
+	}
+
+	cfg, err := Load(path, profiles...)
+	if err != nil {
+		return "", err
+	}
+	var root yaml.Node
+	if err := root.Encode(cfg); err != nil {
+		return "", err
+	}
+
+	n := &root
+	for _, k := range keys {
+		if n = child(n, k); n == nil {
+			return "", fmt.Errorf("%s is not set", key)
+		}
+	}
+	if n.Kind == yaml.ScalarNode {
+		return n.Value, nil
+	}
+	data, err := encode(n)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// Set writes value at a dotted key path of the locom.yml at path, creating
+// missing parents. The value is converted to the type the key has in Config:
+// booleans, integers, lists (comma-separated or [a, b]) and mappings ({k: v})
+// are written as such. The file is edited as YAML nodes, keeping comments,
+// key order and layout, and is only written if the result is a valid
+// configuration.
+func Set(path, key, value string) error {
+	keys := splitPath(key)
+	t, err := typeAt(keys)
+	if err != nil {
+		return err
+	}
+	n, err := valueNode(t, value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	return edit(path, func(root *yaml.Node) error {
+		if err := setNode(root, keys, n); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		return nil
+	})
+}
+
+// AddApp adds an app to the apps section of the locom.yml at path, editing
+// it like Set does. Fields left empty are not written, so they keep their
+// defaults.
+func AddApp(path, name string, app App) error {
+	return AddApps(path, map[string]App{name: app})
+}
+
+// AddApps adds several apps like AddApp, by name, in one edit: either all of
+// them are written or, when one clashes, none.
+func AddApps(path string, apps map[string]App) error {
+	nodes := map[string]*yaml.Node{}
+	for name, app := range apps {
+		var n yaml.Node
+		if err := n.Encode(app); err != nil {
+			return err
+		}
+		nodes[name] = &n
+	}
+	return edit(path, func(root *yaml.Node) error {
+		for _, name := range sortedKeys(nodes) {
+			if section := child(root, "apps"); section != nil && child(section, name) != nil {
+				return fmt.Errorf("app %q already exists", name)
+			}
+			if err := setNode(root, []string{"apps", name}, nodes[name]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// edit applies change to the root mapping of the locom.yml at path and
+// writes the file back if the result is a valid configuration. Lines the
+// change leaves alone are written back as they were, see keepLayout.
+func edit(path string, change func(root *yaml.Node) error) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file %q: %w", path, err)
+	}
+	doc, err := parseData(path, raw)
+	if err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].ShortTag() == "!!null" {
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	if err := change(doc.Content[0]); err != nil {
+		return err
+	}
+
+	data, err := encode(doc)
+	if err != nil {
+		return fmt.Errorf("serializing yaml: %w", err)
+	}
+	data = keepLayout(raw, data)
+	if err := checkData(path, data); err != nil {
+		return fmt.Errorf("not writing %s, the result would be invalid:\n%w", path, err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// keepLayout splices the lines of edited, the re-encoded file, that differ
+// from the original into it, so the blank lines and trailing spaces the
+// encoder drops survive an edit. Blank lines stay before the line that
+// followed them. When the result would not read back as edited does, e.g.
+// in a file indented other than by two spaces, edited is returned as is.
+func keepLayout(orig, edited []byte) []byte {
+	var lines, out []string
+	blanks := map[int][]string{} // the blank lines before lines[i]
+	var pending []string
+	for _, line := range splitLines(orig) {
+		if strings.TrimSpace(line) == "" {
+			pending = append(pending, line)
+			continue
+		}
+		blanks[len(lines)] = pending
+		pending = nil
+		lines = append(lines, line)
+	}
+
+	sameLine := func(x, y string) bool { return strings.TrimRight(x, " \t") == strings.TrimRight(y, " \t") }
+	i := 0
+	for _, op := range diff.Lines(lines, splitLines(edited), sameLine) {
+		if op.Kind == '+' {
+			out = append(out, op.Line)
+			continue
+		}
+		out = append(out, blanks[i]...)
+		if op.Kind == ' ' {
+			out = append(out, op.Line)
+		}
+		i++
+	}
+	out = append(out, pending...)
+	spliced := []byte(strings.Join(out, "\n") + "\n")
+
+	var a, b yaml.Node
+	if yaml.Unmarshal(spliced, &a) != nil || yaml.Unmarshal(edited, &b) != nil {
+		return edited
+	}
+	x, errA := encode(&a)
+	y, errB := encode(&b)
+	if errA != nil || errB != nil || string(x) != string(y) {
+		return edited
+	}
+	return spliced
+}
+
+func splitLines(data []byte) []string {
+	s := strings.TrimSuffix(string(data), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// checkData loads edited file content the way LoadConfig would load it from path.
+func checkData(path string, data []byte) error {
+	doc, err := parseData(path, data)
+	if err != nil {
+		return err
+	}
+	lookup, err := envLookup(filepath.Join(filepath.Dir(path), DotEnvFile))
+	if err != nil {
+		return err
+	}
+	_, err = loadDoc(path, doc, nil, lookup)
+	return err
+}
+
+// typeAt returns the Go type a key path has in Config.
+func typeAt(keys []string) (reflect.Type, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("empty key")
+	}
+	t := reflect.TypeOf(Config{})
+	for i, k := range keys {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		path := strings.Join(keys[:i], ".")
+		switch t.Kind() {
+		case reflect.Struct:
+			fields := yamlFields(t)
+			f, ok := fields[k]
+			if !ok {
+				return nil, fmt.Errorf("unknown key %q (expected one of: %s)", joinPath(path, k), strings.Join(sortedKeys(fields), ", "))
+			}
+			t = f.Type
+		case reflect.Map:
+			t = t.Elem()
+		case reflect.Slice:
+			if _, err := strconv.Atoi(k); err != nil {
+				return nil, fmt.Errorf("%s is a list, expected an index instead of %q", path, k)
+			}
+			t = t.Elem()
+		default:
+			return nil, fmt.Errorf("%s is a %s and has no key %q", path, t.Kind(), k)
+		}
+	}
+	return t, nil
+}
+
+// valueNode converts a command-line value to a node of type t.
+func valueNode(t reflect.Type, value string) (*yaml.Node, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("expected a boolean (true or false), got %q", value)
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(b)}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("expected an integer, got %q", value)
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(i)}, nil
+	case reflect.String:
+		// the encoder quotes values that would otherwise read back as another type, e.g. "2.10"
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}, nil
+	case reflect.Slice:
+		if strings.HasPrefix(strings.TrimSpace(value), "[") {
+			return parseValue(value, yaml.SequenceNode)
+		}
+		seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			n, err := valueNode(t.Elem(), item)
+			if err != nil {
+				return nil, err
+			}
+			seq.Content = append(seq.Content, n)
+		}
+		return seq, nil
+	default:
+		return parseValue(value, yaml.MappingNode)
+	}
+}
+
+func parseValue(value string, kind yaml.Kind) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &doc); err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", value, err)
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: kind}, nil
+	}
+	n := doc.Content[0]
+	if n.Kind != kind {
+		want := "a mapping such as {key: value}"
+		if kind == yaml.SequenceNode {
+			want = "a list such as [a, b]"
+		}
+		return nil, fmt.Errorf("expected %s, got %q", want, value)
+	}
+	if kind == yaml.MappingNode {
+		n.Style = 0 // written in block style like the rest of locom.yml
+	}
+	return n, nil
+}
+
+// setNode puts value at keys below n, creating mappings and lists on the way
+// and keeping the comments of a replaced node.
+func setNode(n *yaml.Node, keys []string, value *yaml.Node) error {
+	key, rest := keys[0], keys[1:]
+
+	if n.ShortTag() == "!!null" {
+		// an empty section such as "apps:" becomes a mapping or a list
+		kind, tag := yaml.MappingNode, "!!map"
+		if _, err := strconv.Atoi(key); err == nil {
+			kind, tag = yaml.SequenceNode, "!!seq"
+		}
+		n.Kind, n.Tag, n.Value, n.Style = kind, tag, "", 0
+	}
+
+	var slot **yaml.Node
+	switch n.Kind {
+	case yaml.MappingNode:
+		idx := keyIndex(n, key)
+		if idx < 0 {
+			n.Content = append(n.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"})
+			idx = len(n.Content) - 2
+		}
+		slot = &n.Content[idx+1]
+	case yaml.SequenceNode:
+		i, _ := strconv.Atoi(key)
+		switch {
+		case i == len(n.Content):
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"})
+		case i < 0 || i > len(n.Content):
+			return fmt.Errorf("index %d out of range (list has %d items)", i, len(n.Content))
+		}
+		slot = &n.Content[i]
+	default:
+		return fmt.Errorf("cannot set %q inside a scalar value", key)
+	}
+
+	if len(rest) > 0 {
+		return setNode(*slot, rest, value)
+	}
+	old := *slot
+	value.HeadComment, value.LineComment, value.FootComment = old.HeadComment, old.LineComment, old.FootComment
+	*slot = value
+	return nil
+}
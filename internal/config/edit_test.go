@@ -0,0 +1,116 @@
+package config_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/localcompose/locom/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+const editBase = `version: 1
+# the stage
+stage:
+  network:
+    name: testnet # docker network
+    bind:
+      address: 127.0.0.1
+apps:
+`
+
+func TestSet_PreservesCommentsAndTypes(t *testing.T) {
+	path := writeProfiles(t, map[string]string{"locom.yml": editBase})
+
+	require.NoError(t, config.Set(path, "stage.network.bind.address", "127.0.0.2"))
+	require.NoError(t, config.Set(path, "stage.network.name", "othernet"))
+	require.NoError(t, config.Set(path, "stage.network.proxy.type.version", "2.10"))
+	require.NoError(t, config.Set(path, "apps.web.port", "8080"))
+	require.NoError(t, config.Set(path, "apps.web.tls", "false"))
+	require.NoError(t, config.Set(path, "apps.web.aliases", "www, site"))
+	require.NoError(t, config.Set(path, "apps.web.aliases[2]", "blog"))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `version: 1
+# the stage
+stage:
+  network:
+    name: othernet # docker network
+    bind:
+      address: 127.0.0.2
+    proxy:
+      type:
+        version: "2.10"
+apps:
+  web:
+    port: 8080
+    tls: false
+    aliases: [www, site, blog]
+`, string(data))
+
+	cfg, err := config.Load(path)
+	require.NoError(t, err)
+	require.Equal(t, 8080, cfg.Apps["web"].Port)
+	require.False(t, cfg.Apps["web"].TLSEnabled())
+}
+
+func TestSet_Rejects(t *testing.T) {
+	path := writeProfiles(t, map[string]string{"locom.yml": editBase})
+
+	require.ErrorContains(t, config.Set(path, "stage.network.bnid", "x"), `unknown key "stage.network.bnid"`)
+	require.ErrorContains(t, config.Set(path, "apps.web.port", "http"), "expected an integer")
+	require.ErrorContains(t, config.Set(path, "apps.web.tls", "maybe"), "expected a boolean")
+	require.ErrorContains(t, config.Set(path, "stage.network.bind.address", "localhost"), "not a valid IP address")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, editBase, string(data), "invalid edits must not be written")
+}
+
+func TestGet(t *testing.T) {
+	path := writeProfiles(t, map[string]string{"locom.yml": editBase + "  web:\n    port: 80\n    aliases: [www]\n"})
+
+	got, err := config.Get(path, "stage.network.name")
+	require.NoError(t, err)
+	require.Equal(t, "testnet", got)
+
+	got, err = config.Get(path, "stage.network.dns.suffix")
+	require.NoError(t, err)
+	require.Equal(t, config.DefaultDNSSuffix, got, "defaults are applied")
+
+	got, err = config.Get(path, "apps.web.aliases")
+	require.NoError(t, err)
+	require.Equal(t, "- www", got)
+
+	_, err = config.Get(path, "apps.api.port")
+	require.ErrorContains(t, err, "not set")
+
+	_, err = config.Get(path, "stage.nope")
+	require.ErrorContains(t, err, "unknown key")
+}
+
+func TestAddApp(t *testing.T) {
+	path := writeProfiles(t, map[string]string{"locom.yml": editBase})
+
+	require.NoError(t, config.AddApp(path, "shop", config.App{Dir: "apps/shop", Port: 3000, Aliases: []string{"www"}}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `version: 1
+# the stage
+stage:
+  network:
+    name: testnet # docker network
+    bind:
+      address: 127.0.0.1
+apps:
+  shop:
+    dir: apps/shop
+    port: 3000
+    aliases:
+      - www
+`, string(data))
+
+	require.ErrorContains(t, config.AddApp(path, "shop", config.App{Port: 80}), `app "shop" already exists`)
+	require.ErrorContains(t, config.AddApp(path, "blog", config.App{}), "apps.blog.port: is required")
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Error is a problem found in locom.yml, located by its YAML position.
+type Error struct {
+	File   string
+	Line   int
+	Column int
+	// Path is the dotted key path of the offending value, e.g. apps.web.port.
+	Path string
+	Msg  string
+
+	// node is the YAML node the problem was found at, used to tell which
+	// file of a profile overlay it came from.
+	node *yaml.Node
+}
+
+func nodeError(n *yaml.Node, path, msg string) *Error {
+	return &Error{Line: n.Line, Column: n.Column, Path: path, Msg: msg, node: n}
+}
+
+// Error formats the problem the way compilers do (file:line:column: message),
+// so editors and CI logs can link it back to the YAML source.
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File + ":")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "%d:%d:", e.Line, e.Column)
+	}
+	if b.Len() > 0 {
+		b.WriteString(" ")
+	}
+	if e.Path != "" {
+		b.WriteString(e.Path + ": ")
+	}
+	b.WriteString(e.Msg)
+	return b.String()
+}
+
+// Errors collects every problem found in one pass over locom.yml.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// withFile attributes each error to the file its node was read from,
+// falling back to file for nodes of unknown origin.
+func (e Errors) withFile(file string, origins map[*yaml.Node]string) Errors {
+	for _, err := range e {
+		err.File = file
+		if f, ok := origins[err.node]; ok && err.node != nil {
+			err.File = f
+		}
+	}
+	return e
+}
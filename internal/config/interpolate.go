@@ -0,0 +1,220 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DotEnvFile holds per-developer variables next to locom.yml; like Docker
+// Compose, variables of the process environment take precedence over it.
+const DotEnvFile = ".env"
+
+// lookupFunc resolves a variable name, reporting whether it is set.
+type lookupFunc func(name string) (string, bool)
+
+// envLookup returns a lookup over the process environment backed by the
+// variables of the given .env file. A missing file is not an error.
+func envLookup(dotEnvPath string) (lookupFunc, error) {
+	vars, err := readDotEnv(dotEnvPath)
+	if err != nil {
+		return nil, err
+	}
+	return func(name string) (string, bool) {
+		if v, ok := os.LookupEnv(name); ok {
+			return v, true
+		}
+		v, ok := vars[name]
+		return v, ok
+	}, nil
+}
+
+// readDotEnv parses KEY=VALUE lines, skipping blanks and # comments. Values
+// may be single- or double-quoted and lines may start with "export ".
+func readDotEnv(path string) (map[string]string, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %q: %w", path, err)
+	}
+
+	vars := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNo)
+		}
+		value = strings.TrimSpace(value)
+		if n := len(value); n >= 2 && (value[0] == '"' || value[0] == '\'') && value[n-1] == value[0] {
+			value = value[1 : n-1]
+		} else if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		vars[key] = value
+	}
+	return vars, scanner.Err()
+}
+
+// interpolateNode expands variables in every scalar value below n, keeping
+// keys untouched. Plain scalars are re-typed after expansion so that
+// "port: ${PORT}" decodes as an integer.
+func interpolateNode(n *yaml.Node, lookup lookupFunc, path string, errs *Errors) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			interpolateNode(c, lookup, path, errs)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			interpolateNode(n.Content[i+1], lookup, joinPath(path, n.Content[i].Value), errs)
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			interpolateNode(c, lookup, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(n.Value, "$") {
+			return
+		}
+		value, err := interpolate(n.Value, lookup)
+		if err != nil {
+			*errs = append(*errs, nodeError(n, path, err.Error()))
+			return
+		}
+		if value != n.Value {
+			n.Value = value
+			if n.Style == 0 {
+				n.Tag = ""
+			}
+		}
+	}
+}
+
+// interpolate expands $VAR and ${VAR} the way Docker Compose does, including
+// the ${VAR:-default}, ${VAR-default}, ${VAR:?error}, ${VAR?error},
+// ${VAR:+replacement} and ${VAR+replacement} forms. $$ is a literal $.
+func interpolate(s string, lookup lookupFunc) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		switch next := s[i+1]; {
+		case next == '$':
+			b.WriteByte('$')
+			i++
+		case next == '{':
+			end := matchingBrace(s, i+1)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable in %q", s)
+			}
+			value, err := expand(s[i+2:end], lookup)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(value)
+			i = end
+		case isNameStart(next):
+			j := i + 1
+			for j < len(s) && isNameChar(s[j]) {
+				j++
+			}
+			value, _ := lookup(s[i+1 : j])
+			b.WriteString(value)
+			i = j - 1
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String(), nil
+}
+
+// expand resolves the inside of ${...}.
+func expand(expr string, lookup lookupFunc) (string, error) {
+	j := 0
+	for j < len(expr) && isNameChar(expr[j]) {
+		j++
+	}
+	name, op := expr[:j], expr[j:]
+	if name == "" || !isNameStart(name[0]) {
+		return "", fmt.Errorf("invalid variable name in ${%s}", expr)
+	}
+	value, set := lookup(name)
+	if op == "" {
+		return value, nil
+	}
+
+	emptyIsUnset := strings.HasPrefix(op, ":")
+	op = strings.TrimPrefix(op, ":")
+	if op == "" {
+		return "", fmt.Errorf("invalid variable expression ${%s}", expr)
+	}
+	set = set && !(emptyIsUnset && value == "")
+
+	arg, err := interpolate(op[1:], lookup)
+	if err != nil {
+		return "", err
+	}
+	switch op[0] {
+	case '-':
+		if !set {
+			return arg, nil
+		}
+		return value, nil
+	case '+':
+		if set {
+			return arg, nil
+		}
+		return "", nil
+	case '?':
+		if !set {
+			if arg == "" {
+				arg = "is required"
+			}
+			return "", fmt.Errorf("variable %s %s", name, arg)
+		}
+		return value, nil
+	}
+	return "", fmt.Errorf("invalid variable expression ${%s}", expr)
+}
+
+// matchingBrace returns the index of the } closing the { at open, allowing nested ${...}.
+func matchingBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
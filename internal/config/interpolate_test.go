@@ -0,0 +1,69 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterpolate(t *testing.T) {
+	vars := map[string]string{"ADDR": "127.0.0.2", "EMPTY": "", "NAME": "web"}
+	lookup := func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"${ADDR}", "127.0.0.2"},
+		{"$ADDR:80", "127.0.0.2:80"},
+		{"$$ADDR", "$ADDR"},
+		{"${MISSING}", ""},
+		{"${MISSING:-127.0.0.1}", "127.0.0.1"},
+		{"${EMPTY:-fallback}", "fallback"},
+		{"${EMPTY-fallback}", ""},
+		{"${MISSING-fallback}", "fallback"},
+		{"${NAME:+set}", "set"},
+		{"${EMPTY:+set}", ""},
+		{"${EMPTY+set}", "set"},
+		{"${MISSING:-${NAME}.locom.self}", "web.locom.self"},
+		{"price: 5$", "price: 5$"},
+	}
+	for _, tt := range tests {
+		got, err := interpolate(tt.in, lookup)
+		require.NoError(t, err, tt.in)
+		require.Equal(t, tt.want, got, tt.in)
+	}
+
+	for _, in := range []string{"${MISSING:?set it}", "${EMPTY:?}", "${ADDR", "${1X}"} {
+		_, err := interpolate(in, lookup)
+		require.Error(t, err, in)
+	}
+}
+
+func TestReadDotEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	require.NoError(t, os.WriteFile(path, []byte(`# per-developer settings
+BIND=127.0.0.2
+export SUFFIX=".dev.self"
+QUOTED='a # b'
+COMMENTED=value # trailing
+`), 0644))
+
+	vars, err := readDotEnv(path)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"BIND":      "127.0.0.2",
+		"SUFFIX":    ".dev.self",
+		"QUOTED":    "a # b",
+		"COMMENTED": "value",
+	}, vars)
+
+	vars, err = readDotEnv(filepath.Join(t.TempDir(), ".env"))
+	require.NoError(t, err)
+	require.Empty(t, vars)
+}
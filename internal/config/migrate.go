@@ -0,0 +1,185 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the locom.yml format written by this release. Files
+// without a version key are version 0.
+const CurrentVersion = 1
+
+// Migration upgrades a locom.yml document from version From to From+1 by
+// editing its YAML nodes, so comments and key order survive. Migrations must
+// cope with partial documents, as profile overlays are migrated too.
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(root *yaml.Node) error
+}
+
+// migrations is ordered by From; there is exactly one per version step.
+var migrations = []Migration{
+	{
+		From:        0,
+		Description: "add the version key and quote stage.network.proxy.type.version",
+		Apply: func(root *yaml.Node) error {
+			if typ := lookupNode(root, "stage.network.proxy.type.version"); typ != nil && typ.Kind == yaml.ScalarNode {
+				typ.Tag = "!!str"
+				typ.Style = yaml.DoubleQuotedStyle
+			}
+			return nil
+		},
+	},
+}
+
+// fileVersion reads the version key of a parsed document.
+func fileVersion(root *yaml.Node) (int, error) {
+	n := lookupNode(root, "version")
+	if n == nil {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(n.Value)
+	if err != nil || v < 0 {
+		return 0, nodeError(n, "version", fmt.Sprintf("expected a non-negative integer, got %q", n.Value))
+	}
+	return v, nil
+}
+
+// migrateDoc brings a parsed document to CurrentVersion and reports the
+// version it started from.
+func migrateDoc(doc *yaml.Node) (int, error) {
+	root := documentRoot(doc)
+	if root == nil {
+		return CurrentVersion, nil
+	}
+	if root.Kind != yaml.MappingNode {
+		return 0, nil
+	}
+
+	from, err := fileVersion(root)
+	if err != nil {
+		return 0, err
+	}
+	if from > CurrentVersion {
+		n := lookupNode(root, "version")
+		return 0, nodeError(n, "version", fmt.Sprintf("format version %d was written by a newer locom; this release supports up to version %d", from, CurrentVersion))
+	}
+
+	for _, m := range migrations {
+		if m.From < from {
+			continue
+		}
+		if err := m.Apply(root); err != nil {
+			return 0, fmt.Errorf("migrating from version %d (%s): %w", m.From, m.Description, err)
+		}
+		setVersion(root, m.From+1)
+	}
+	return from, nil
+}
+
+// setVersion writes the version key, adding it as the first key if missing.
+func setVersion(root *yaml.Node, version int) {
+	value := strconv.Itoa(version)
+	if n := lookupNode(root, "version"); n != nil {
+		n.Value, n.Tag, n.Style = value, "!!int", 0
+		return
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+	if len(root.Content) > 0 {
+		// keep a comment heading the file above the new key
+		key.HeadComment, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+	}
+	root.Content = append([]*yaml.Node{key, {Kind: yaml.ScalarNode, Tag: "!!int", Value: value}}, root.Content...)
+}
+
+// MigrateResult describes one file upgraded by MigrateFiles.
+type MigrateResult struct {
+	Path   string
+	Backup string
+	From   int
+}
+
+// MigrateFiles upgrades locom.yml and its profile overlays in place to
+// CurrentVersion. The original of every rewritten file is kept next to it
+// as <name>.v<from>.bak; files already up to date are left untouched.
+func MigrateFiles(path string) ([]MigrateResult, error) {
+	files := []string{path}
+	overlays, err := filepath.Glob(ProfilePath(path, "*"))
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, overlays...)
+
+	var results []MigrateResult
+	for _, file := range files {
+		res, err := migrateFile(file)
+		if err != nil {
+			return results, err
+		}
+		if res != nil {
+			results = append(results, *res)
+		}
+	}
+	return results, nil
+}
+
+func migrateFile(path string) (*MigrateResult, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file %q: %w", path, err)
+	}
+	doc, err := parseData(path, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := migrateDoc(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if from == CurrentVersion {
+		return nil, nil
+	}
+
+	data, err := encode(doc)
+	if err != nil {
+		return nil, fmt.Errorf("serializing %q: %w", path, err)
+	}
+	data = keepLayout(raw, data)
+
+	backup := fmt.Sprintf("%s.v%d.bak", path, from)
+	if err := os.WriteFile(backup, raw, 0644); err != nil {
+		return nil, fmt.Errorf("writing backup: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("writing %q: %w", path, err)
+	}
+	return &MigrateResult{Path: path, Backup: backup, From: from}, nil
+}
+
+func documentRoot(doc *yaml.Node) *yaml.Node {
+	if doc.Kind == yaml.DocumentNode {
+		if len(doc.Content) == 0 {
+			return nil
+		}
+		return doc.Content[0]
+	}
+	return doc
+}
+
+// lookupNode returns the node at the dotted path, or nil if it does not exist.
+func lookupNode(root *yaml.Node, path string) *yaml.Node {
+	n := root
+	for _, key := range strings.Split(path, ".") {
+		if n = child(n, key); n == nil {
+			return nil
+		}
+	}
+	return n
+}
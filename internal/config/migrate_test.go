@@ -0,0 +1,93 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/localcompose/locom/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+const configV0 = `# team stage
+stage:
+  network:
+    name: testnet # shared with other stacks
+    proxy:
+      type:
+        engine: traefik
+        version: 2.10
+apps:
+`
+
+func TestMigrateFiles(t *testing.T) {
+	path := writeProfiles(t, map[string]string{
+		"locom.yml":      configV0,
+		"locom.full.yml": "apps:\n  web:\n    port: 80\n",
+	})
+
+	results, err := config.MigrateFiles(path)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, path, results[0].Path)
+	require.Equal(t, 0, results[0].From)
+	require.Equal(t, path+".v0.bak", results[0].Backup)
+
+	backup, err := os.ReadFile(results[0].Backup)
+	require.NoError(t, err)
+	require.Equal(t, configV0, string(backup))
+
+	migrated, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(migrated), "# team stage\nversion: 1\n")
+	require.Contains(t, string(migrated), "name: testnet # shared with other stacks")
+	require.Contains(t, string(migrated), `version: "2.10"`)
+
+	cfg, err := config.Load(path, "full")
+	require.NoError(t, err)
+	require.Equal(t, config.CurrentVersion, cfg.Version)
+	require.Equal(t, "2.10", cfg.Stage.Network.Proxy.Type.Version)
+
+	results, err = config.MigrateFiles(path)
+	require.NoError(t, err)
+	require.Empty(t, results, "up-to-date files are left alone")
+}
+
+func TestLoad_MigratesInMemory(t *testing.T) {
+	path := writeProfiles(t, map[string]string{"locom.yml": configV0})
+
+	cfg, err := config.Load(path)
+	require.NoError(t, err)
+	require.Equal(t, config.CurrentVersion, cfg.Version)
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, configV0, string(raw), "loading must not rewrite the file")
+}
+
+func TestLoad_RejectsNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locom.yml")
+	require.NoError(t, os.WriteFile(path, []byte("version: 99\nstage:\n  network:\n    name: testnet\n"), 0644))
+
+	_, err := config.Load(path)
+	var errs config.Errors
+	require.ErrorAs(t, err, &errs)
+	require.Equal(t, 1, errs[0].Line)
+	require.Contains(t, errs[0].Msg, "newer locom")
+
+	_, err = config.MigrateFiles(path)
+	require.Error(t, err)
+}
+
+func TestMigrateFiles_KeepsLayout(t *testing.T) {
+	path := writeProfiles(t, map[string]string{
+		"locom.yml": "# team stage\n\nstage:\n  network:\n    name: testnet # shared\n\n    proxy:\n      type:\n        engine: traefik\n        version: 2.10\n\napps:\n",
+	})
+
+	_, err := config.MigrateFiles(path)
+	require.NoError(t, err)
+
+	migrated, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "# team stage\n\nversion: 1\n\nstage:\n  network:\n    name: testnet # shared\n\n    proxy:\n      type:\n        engine: traefik\n        version: \"2.10\"\n\napps:\n", string(migrated))
+}
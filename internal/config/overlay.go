@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProfileEnv selects the profiles to apply when no --profile flag is given.
+// It may also be set in .locom/.env.
+const ProfileEnv = "LOCOM_PROFILE"
+
+// resetTag removes a key inherited from the base file, e.g. "apps: {heavy: !reset}".
+const resetTag = "!reset"
+
+// ProfilePath is the overlay file of a profile, next to the base locom.yml:
+// .locom/locom.yml with profile "full" gives .locom/locom.full.yml.
+func ProfilePath(path, profile string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + profile + ext
+}
+
+// ParseProfiles parses a comma-separated list of profiles, applied in order,
+// such as the value of --profile.
+func ParseProfiles(list string) ([]string, error) {
+	var profiles []string
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !dnsLabelRe.MatchString(p) {
+			return nil, fmt.Errorf("invalid profile name %q (allowed: a-z, 0-9, -)", p)
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// merge deep-merges overlay into base: mappings are merged key by key,
+// any other value replaces the base value. Nodes taken from the overlay
+// are recorded in origins with the overlay's file.
+func merge(base, overlay *yaml.Node, file string, origins map[*yaml.Node]string) *yaml.Node {
+	if base.Kind == yaml.DocumentNode && overlay.Kind == yaml.DocumentNode {
+		if len(overlay.Content) == 0 {
+			return base
+		}
+		if len(base.Content) == 0 {
+			base.Content = overlay.Content
+			markOrigin(overlay, file, origins)
+			return base
+		}
+		base.Content[0] = merge(base.Content[0], overlay.Content[0], file, origins)
+		return base
+	}
+
+	if base.Kind != yaml.MappingNode || overlay.Kind != yaml.MappingNode {
+		markOrigin(overlay, file, origins)
+		return overlay
+	}
+
+	origins[overlay] = file
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		key, value := overlay.Content[i], overlay.Content[i+1]
+		idx := keyIndex(base, key.Value)
+
+		switch {
+		case value.Tag == resetTag:
+			if idx >= 0 {
+				base.Content = append(base.Content[:idx], base.Content[idx+2:]...)
+			}
+		case idx >= 0:
+			base.Content[idx+1] = merge(base.Content[idx+1], value, file, origins)
+		default:
+			markOrigin(key, file, origins)
+			markOrigin(value, file, origins)
+			base.Content = append(base.Content, key, value)
+		}
+	}
+	return base
+}
+
+func keyIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func markOrigin(n *yaml.Node, file string, origins map[*yaml.Node]string) {
+	origins[n] = file
+	for _, c := range n.Content {
+		markOrigin(c, file, origins)
+	}
+}
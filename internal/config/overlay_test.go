@@ -0,0 +1,103 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/localcompose/locom/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func writeProfiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	return filepath.Join(dir, "locom.yml")
+}
+
+const profileBase = `stage:
+  network:
+    name: testnet
+    dns:
+      suffix: .locom.self
+apps:
+  web:
+    port: 80
+    aliases: [www]
+  heavy:
+    port: 9000
+`
+
+func TestLoad_ProfileOverlay(t *testing.T) {
+	path := writeProfiles(t, map[string]string{
+		"locom.yml": profileBase,
+		"locom.minimal.yml": `apps:
+  heavy: !reset
+  web:
+    aliases: [site]
+`,
+		"locom.full.yml": `stage:
+  network:
+    bind:
+      address: 127.0.0.2
+apps:
+  search:
+    port: 9200
+`,
+	})
+
+	cfg, err := config.Load(path, "minimal")
+	require.NoError(t, err)
+	require.Equal(t, "testnet", cfg.Stage.Network.Name)
+	require.Equal(t, []string{"site"}, cfg.Apps["web"].Aliases, "lists are replaced")
+	require.Equal(t, 80, cfg.Apps["web"].Port, "mappings are merged")
+	require.NotContains(t, cfg.Apps, "heavy")
+
+	cfg, err = config.Load(path, "minimal", "full")
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.2", cfg.Stage.Network.Bind.Address)
+	require.Equal(t, ".locom.self", cfg.Stage.Network.DNS.Suffix)
+	require.Contains(t, cfg.Apps, "search")
+	require.NotContains(t, cfg.Apps, "heavy")
+}
+
+func TestLoadConfig_ProfileFromEnv(t *testing.T) {
+	path := writeProfiles(t, map[string]string{
+		"locom.yml":      profileBase,
+		"locom.full.yml": "apps:\n  web:\n    port: 8080\n",
+	})
+
+	t.Setenv(config.ProfileEnv, "full")
+	cfg, err := config.LoadConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, 8080, cfg.Apps["web"].Port)
+
+	t.Setenv(config.ProfileEnv, "missing")
+	_, err = config.LoadConfig(path)
+	require.ErrorContains(t, err, `profile "missing"`)
+}
+
+func TestLoad_ProfileErrorsPointAtOverlay(t *testing.T) {
+	path := writeProfiles(t, map[string]string{
+		"locom.yml":     profileBase,
+		"locom.bad.yml": "apps:\n  web:\n    port: 0\n  extra:\n    prot: 1\n",
+	})
+
+	_, err := config.Load(path, "bad")
+	var errs config.Errors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 1)
+	require.Equal(t, config.ProfilePath(path, "bad"), errs[0].File)
+	require.Equal(t, 5, errs[0].Line)
+
+	require.NoError(t, os.WriteFile(config.ProfilePath(path, "bad"), []byte("apps:\n  web:\n    port: 0\n"), 0644))
+	_, err = config.Load(path, "bad")
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 1)
+	require.Equal(t, config.ProfilePath(path, "bad"), errs[0].File)
+	require.Equal(t, "apps.web.port", errs[0].Path)
+	require.Equal(t, 3, errs[0].Line)
+}
@@ -0,0 +1,293 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// SchemaID is where the published JSON Schema of locom.yml can be fetched from.
+const SchemaID = "https://raw.githubusercontent.com/localcompose/locom/main/schema/locom.schema.json"
+
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	ID                   string                 `json:"$id,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 any                    `json:"type,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	AdditionalProperties any                    `json:"additionalProperties,omitempty"`
+	PropertyNames        *jsonSchema            `json:"propertyNames,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Enum                 []any                  `json:"enum,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Minimum              *int                   `json:"minimum,omitempty"`
+	Maximum              *int                   `json:"maximum,omitempty"`
+	Default              any                    `json:"default,omitempty"`
+	Examples             []any                  `json:"examples,omitempty"`
+}
+
+// Schema returns the JSON Schema (draft-07) of locom.yml. The structure is
+// derived from the Config types; schemaHints adds documentation and constraints.
+func Schema() ([]byte, error) {
+	s := schemaFor(reflect.TypeOf(Config{}), "")
+	s.Schema = "http://json-schema.org/draft-07/schema#"
+	s.ID = SchemaID
+	s.Title = "locom stage configuration"
+	s.Description = "Configuration of a locom stage, stored in .locom/locom.yml."
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func schemaFor(t reflect.Type, path string) *jsonSchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	s := &jsonSchema{}
+	switch t.Kind() {
+	case reflect.Struct:
+		s.Type = "object"
+		s.AdditionalProperties = false
+		s.Properties = map[string]*jsonSchema{}
+		for name, f := range yamlFields(t) {
+			s.Properties[name] = schemaFor(f.Type, joinPath(path, name))
+		}
+	case reflect.Map:
+		s.Type = "object"
+		s.AdditionalProperties = schemaFor(t.Elem(), joinPath(path, "*"))
+	case reflect.Slice:
+		s.Type = "array"
+		s.Items = schemaFor(t.Elem(), path+"[]")
+	case reflect.String:
+		s.Type = "string"
+	case reflect.Bool:
+		s.Type = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s.Type = "integer"
+	}
+
+	if hint, ok := schemaHints[path]; ok {
+		s.merge(hint)
+	}
+	return s
+}
+
+func (s *jsonSchema) merge(hint jsonSchema) {
+	if hint.Description != "" {
+		s.Description = hint.Description
+	}
+	if hint.Type != nil {
+		s.Type = hint.Type
+	}
+	if hint.PropertyNames != nil {
+		s.PropertyNames = hint.PropertyNames
+	}
+	if hint.Required != nil {
+		s.Required = hint.Required
+	}
+	if hint.Enum != nil {
+		s.Enum = hint.Enum
+	}
+	if hint.Pattern != "" {
+		s.Pattern = hint.Pattern
+	}
+	if hint.Minimum != nil {
+		s.Minimum = hint.Minimum
+	}
+	if hint.Maximum != nil {
+		s.Maximum = hint.Maximum
+	}
+	if hint.Default != nil {
+		s.Default = hint.Default
+	}
+	if hint.Examples != nil {
+		s.Examples = hint.Examples
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+var (
+	dnsLabelPattern = strings.Trim(dnsLabelRe.String(), "^$")
+	// dnsSuffixPattern is a dot followed by one or more DNS labels.
+	dnsSuffixPattern = `^(\.` + dnsLabelPattern + `)+$`
+	hostnamePattern  = `^` + dnsLabelPattern + `(\.` + dnsLabelPattern + `)*$`
+)
+
+// schemaHints documents and constrains the schema by dotted path; map values are addressed with *.
+var schemaHints = map[string]jsonSchema{
+	"version": {
+		Description: "Format version of this file. Older files are migrated with `locom config migrate`.",
+		Minimum:     intPtr(0),
+		Maximum:     intPtr(CurrentVersion),
+		Default:     CurrentVersion,
+	},
+	"stage": {
+		Description: "The local stage: one Docker network fronted by one reverse proxy.",
+	},
+	"stage.name": {
+		Description: "Tells stages apart on one host, e.g. in compose project and container names. Defaults to the stage folder name.",
+		Pattern:     projectNameRe.String(),
+	},
+	"stage.network": {
+		Description: "Docker network shared by the proxy and all apps of the stage.",
+		Required:    []string{"name"},
+	},
+	"stage.network.name": {
+		Description: "Name of the external Docker network, created by `locom network`.",
+		Pattern:     dockerNameRe.String(),
+		Examples:    []any{"locom"},
+	},
+	"stage.network.bind": {
+		Description: "Where the stage is reachable from the host.",
+	},
+	"stage.network.bind.address": {
+		Description: "IP address the stage hostnames resolve to in the hosts file and the proxy publishes its ports on. Use distinct loopback addresses (127.0.0.2, ...) to run several stages side by side.",
+		Default:     DefaultBindAddress,
+		Examples:    []any{"127.0.0.1", "127.0.0.2"},
+	},
+	"stage.network.bind.ports": {
+		Description: "Host ports the proxy publishes on the bind address.",
+	},
+	"stage.network.bind.ports.http": {
+		Description: "Host port of the http entrypoint.",
+		Minimum:     intPtr(1),
+		Maximum:     intPtr(65535),
+		Default:     DefaultHTTPPort,
+	},
+	"stage.network.bind.ports.https": {
+		Description: "Host port of the https entrypoint.",
+		Minimum:     intPtr(1),
+		Maximum:     intPtr(65535),
+		Default:     DefaultHTTPSPort,
+	},
+	"stage.network.bind.ports.dashboard": {
+		Description: "Host port of the proxy dashboard.",
+		Minimum:     intPtr(1),
+		Maximum:     intPtr(65535),
+		Default:     DefaultDashboardPort,
+	},
+	"stage.network.dns": {
+		Description: "Hostnames of the stage.",
+	},
+	"stage.network.dns.suffix": {
+		Description: "Domain appended to the proxy and app hostnames; must start with a dot.",
+		Pattern:     dnsSuffixPattern,
+		Default:     DefaultDNSSuffix,
+	},
+	"stage.network.proxy": {
+		Description: "Reverse proxy routing requests to the apps.",
+	},
+	"stage.network.proxy.name": {
+		Description: "Name of the proxy container, the engine name by default.",
+		Pattern:     dockerNameRe.String(),
+		Default:     DefaultProxyEngine,
+	},
+	"stage.network.proxy.type": {
+		Description: "Proxy implementation and version.",
+	},
+	"stage.network.proxy.type.engine": {
+		Description: "Reverse proxy implementation.",
+		Enum:        stringsToAny(sortedKeys(ProxyVersions)),
+		Default:     DefaultProxyEngine,
+	},
+	"stage.network.proxy.type.version": {
+		Description: "Version of the proxy engine, 2.10 for traefik and caddy, 1.28 for nginx by default. Unquoted values such as 2.10 are accepted.",
+		Type:        []string{"string", "number"},
+		Default:     DefaultProxyVersion,
+		Examples:    stringsToAny(ProxyVersions[DefaultProxyEngine]),
+	},
+	"stage.network.proxy.tls": {
+		Description: "Entrypoints the proxy serves: redirect (https, http redirects to it), https (https only), http (plain http only, no certificate) or both (http and https without redirect).",
+		Enum:        []any{string(TLSRedirect), string(TLSOnly), string(TLSOff), string(TLSBoth)},
+		Default:     string(DefaultTLSMode),
+	},
+	"stage.network.proxy.dashboard": {
+		Description: "How the proxy API and dashboard are exposed.",
+	},
+	"stage.network.proxy.dashboard.insecure": {
+		Description: "Publish the API unauthenticated on the dashboard port. When false, the dashboard is only served on the proxy hostname.",
+		Default:     true,
+	},
+	"stage.network.proxy.dashboard.user": {
+		Description: "Protect the dashboard with basic-auth for this user. Set the password with 'locom proxy passwd'.",
+		Pattern:     htpasswdUserRe.String(),
+	},
+	"apps": {
+		Description:   "Compose services reachable through the proxy, keyed by app name.",
+		Type:          []string{"object", "null"},
+		PropertyNames: &jsonSchema{Pattern: dnsLabelRe.String()},
+	},
+	"apps.*": {
+		Description: "An app of the stage. dir, service and host default to the app name.",
+		Required:    []string{"port"},
+	},
+	"apps.*.dir": {
+		Description: "Folder holding the app's compose file, relative to the stage root and inside it.",
+	},
+	"apps.*.service": {
+		Description: "Compose service receiving the traffic.",
+		Pattern:     dockerNameRe.String(),
+	},
+	"apps.*.host": {
+		Description: "Hostname prefix; the app answers on host + dns.suffix.",
+		Pattern:     hostnamePattern,
+	},
+	"apps.*.port": {
+		Description: "Port the service listens on inside its container.",
+		Minimum:     intPtr(1),
+		Maximum:     intPtr(65535),
+	},
+	"apps.*.path": {
+		Description: "Only route requests below this path prefix; apps may share a hostname below distinct paths.",
+		Pattern:     pathRe.String(),
+	},
+	"apps.*.strip": {
+		Description: "Remove the path prefix from requests before passing them to the app.",
+		Default:     false,
+	},
+	"apps.*.headers": {
+		Description: "Only route requests carrying these header values (traefik only).",
+	},
+	"apps.*.tls": {
+		Description: "Serve the app over https; for tcp apps, accept TLS connections routed by SNI rather than plain ones.",
+		Default:     true,
+	},
+	"apps.*.aliases": {
+		Description: "Extra hostname prefixes the app answers on.",
+	},
+	"apps.*.aliases[]": {
+		Pattern: hostnamePattern,
+	},
+	"apps.*.protocol": {
+		Description: "How the proxy routes the app: http by hostname and path, or tcp and udp on the app's entrypoint (traefik only).",
+		Enum:        stringsToAny(Protocols),
+		Default:     ProtocolHTTP,
+	},
+	"apps.*.entrypoint": {
+		Description: "Port the proxy listens on for a tcp or udp app, on the bind address. TCP apps with tls are routed by SNI and may share one.",
+		Minimum:     intPtr(1),
+		Maximum:     intPtr(65535),
+	},
+	"apps.*.passthrough": {
+		Description: "Forward the TLS connections of a tcp app untouched, for apps terminating TLS themselves, instead of terminating them with the stage certificate.",
+		Default:     false,
+	},
+}
+
+func stringsToAny(values []string) []any {
+	out := make([]any, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out
+}
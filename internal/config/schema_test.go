@@ -0,0 +1,57 @@
+package config_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/localcompose/locom/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchema_Structure(t *testing.T) {
+	data, err := config.Schema()
+	require.NoError(t, err)
+
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal(data, &schema))
+
+	network := dig(t, schema, "properties", "stage", "properties", "network")
+	require.Equal(t, []any{"name"}, network["required"])
+	require.Equal(t, false, network["additionalProperties"])
+
+	proxyType := dig(t, network, "properties", "proxy", "properties", "type", "properties")
+	require.Contains(t, proxyType, "engine")
+	require.Contains(t, proxyType, "version")
+
+	app := dig(t, schema, "properties", "apps", "additionalProperties")
+	require.Equal(t, []any{"port"}, app["required"])
+	// a null app fails validation, so the schema does not allow it either
+	require.Equal(t, "object", app["type"])
+	require.Contains(t, app["properties"], "aliases")
+}
+
+// The published schema must be regenerated whenever the config types change:
+//
+//	make schema
+func TestSchema_PublishedFileUpToDate(t *testing.T) {
+	data, err := config.Schema()
+	require.NoError(t, err)
+
+	published, err := os.ReadFile(filepath.Join("..", "..", "schema", "locom.schema.json"))
+	require.NoError(t, err)
+	if string(data) != string(published) {
+		t.Fatal("schema/locom.schema.json is stale, run 'make schema'")
+	}
+}
+
+func dig(t *testing.T, m map[string]any, keys ...string) map[string]any {
+	t.Helper()
+	for _, k := range keys {
+		next, ok := m[k].(map[string]any)
+		require.True(t, ok, "missing key %q", k)
+		m = next
+	}
+	return m
+}
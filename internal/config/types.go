@@ -1,24 +1,182 @@
 package config
 
+import "slices"
+
 type Config struct {
-	Stage struct {
-		Network struct {
-			Name string `yaml:"name"`
-			Bind struct {
-				Address string `yaml:"address"`
-			} `yaml:"bind"`
-			DNS struct {
-				Suffix string `yaml:"suffix"`
-			} `yaml:"dns"`
-			Proxy struct {
-				Name string `yaml:"name"`
-				Type struct {
-					Engine  string `yaml:"engine"`
-					Version string `yaml:"version"`
-				} `yaml:"type"`
-			} `yaml:"proxy"`
-		} `yaml:"network"`
-	} `yaml:"stage"`
-
-	Apps map[string]any `yaml:"apps"`
+	// Version is the format version of the file, see CurrentVersion.
+	Version int `yaml:"version"`
+
+	Stage Stage `yaml:"stage"`
+
+	Apps map[string]App `yaml:"apps"`
+}
+
+type Stage struct {
+	// Name tells stages apart on one host, e.g. in compose project and
+	// container names; it defaults to the name of the stage folder.
+	Name    string  `yaml:"name,omitempty"`
+	Network Network `yaml:"network"`
+}
+
+type Network struct {
+	Name  string `yaml:"name"`
+	Bind  Bind   `yaml:"bind"`
+	DNS   DNS    `yaml:"dns"`
+	Proxy Proxy  `yaml:"proxy"`
+}
+
+type Bind struct {
+	Address string `yaml:"address"`
+	Ports   Ports  `yaml:"ports"`
+}
+
+// Ports are the host ports the proxy publishes on the bind address.
+type Ports struct {
+	HTTP      int `yaml:"http"`
+	HTTPS     int `yaml:"https"`
+	Dashboard int `yaml:"dashboard"`
+}
+
+type DNS struct {
+	Suffix string `yaml:"suffix"`
+}
+
+type Proxy struct {
+	Name string    `yaml:"name"`
+	Type ProxyType `yaml:"type"`
+	// TLS selects which of http and https the proxy serves.
+	TLS TLSMode `yaml:"tls"`
+	// Dashboard controls how the proxy's API and dashboard are exposed.
+	Dashboard Dashboard `yaml:"dashboard"`
+}
+
+type Dashboard struct {
+	// Insecure serves the API unauthenticated on the dashboard port; it is on
+	// unless explicitly disabled, leaving the proxy hostname as the only way in.
+	Insecure *bool `yaml:"insecure,omitempty"`
+	// User protects the dashboard with basic-auth; its password hash is kept
+	// in .locom/dashboard.htpasswd.
+	User string `yaml:"user,omitempty"`
+}
+
+// InsecureEnabled reports whether the API is published unauthenticated.
+func (d Dashboard) InsecureEnabled() bool {
+	return d.Insecure == nil || *d.Insecure
+}
+
+type ProxyType struct {
+	Engine  string `yaml:"engine"`
+	Version string `yaml:"version"`
+}
+
+// TLSMode selects the entrypoints the proxy serves.
+type TLSMode string
+
+const (
+	// TLSRedirect serves https and redirects http requests to it.
+	TLSRedirect TLSMode = "redirect"
+	// TLSOnly serves https only; nothing listens on the http port.
+	TLSOnly TLSMode = "https"
+	// TLSOff serves plain http only; no certificate is needed.
+	TLSOff TLSMode = "http"
+	// TLSBoth serves http and https side by side without redirecting.
+	TLSBoth TLSMode = "both"
+)
+
+// TLSModes lists the valid TLS modes.
+var TLSModes = []TLSMode{TLSRedirect, TLSOnly, TLSOff, TLSBoth}
+
+// HTTP reports whether the proxy listens on the http port, either to serve
+// or to redirect.
+func (m TLSMode) HTTP() bool {
+	return m != TLSOnly
+}
+
+// HTTPS reports whether the proxy serves https and so needs a certificate.
+func (m TLSMode) HTTPS() bool {
+	return m != TLSOff
+}
+
+// App is a Docker Compose service of the stage that is reachable through the proxy.
+// Empty Dir, Service and Host default to the app's key in the apps section.
+type App struct {
+	// Dir is the folder holding the app's compose file, relative to the stage root.
+	Dir string `yaml:"dir,omitempty"`
+	// Service is the compose service receiving the traffic.
+	Service string `yaml:"service,omitempty"`
+	// Host is the hostname prefix; the app answers on Host + dns.suffix.
+	Host string `yaml:"host,omitempty"`
+	// Port is the port the service listens on inside its container.
+	Port int `yaml:"port,omitempty"`
+	// Path restricts routing to requests below this path prefix. Apps may
+	// share a hostname below distinct paths.
+	Path string `yaml:"path,omitempty"`
+	// Strip removes Path from requests before passing them to the app.
+	Strip bool `yaml:"strip,omitempty"`
+	// Headers restricts routing to requests carrying these header values.
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// TLS serves the app over https; it is on unless explicitly disabled.
+	TLS *bool `yaml:"tls,omitempty"`
+	// Aliases are extra hostname prefixes the app answers on.
+	Aliases []string `yaml:"aliases,omitempty"`
+	// Protocol is how the proxy routes the app: http, or tcp and udp on
+	// EntryPoint.
+	Protocol string `yaml:"protocol,omitempty"`
+	// EntryPoint is the port the proxy listens on for a tcp or udp app. TCP
+	// apps with tls are told apart by SNI and may share one.
+	EntryPoint int `yaml:"entrypoint,omitempty"`
+	// Passthrough forwards the TLS connections of a tcp app untouched, to an
+	// app terminating TLS itself, instead of terminating them with the stage
+	// certificate.
+	Passthrough bool `yaml:"passthrough,omitempty"`
+}
+
+// Protocols an app is routed with.
+const (
+	ProtocolHTTP = "http"
+	ProtocolTCP  = "tcp"
+	ProtocolUDP  = "udp"
+)
+
+// Protocols lists the valid app protocols.
+var Protocols = []string{ProtocolHTTP, ProtocolTCP, ProtocolUDP}
+
+// HTTP reports whether the app is routed by hostname and path on the http
+// and https entrypoints.
+func (a App) HTTP() bool {
+	return a.Protocol == "" || a.Protocol == ProtocolHTTP
+}
+
+// TLSEnabled reports whether the app is served over https.
+func (a App) TLSEnabled() bool {
+	return a.TLS == nil || *a.TLS
+}
+
+// ProxyHostPrefix is the hostname prefix the proxy itself (its dashboard) answers on.
+const ProxyHostPrefix = "proxy"
+
+// Hostname is the fully qualified name of a hostname prefix in the stage.
+func (c *Config) Hostname(prefix string) string {
+	return prefix + c.Stage.Network.DNS.Suffix
+}
+
+// ProxyHostname is the fully qualified name of the proxy, e.g. proxy.locom.self.
+func (c *Config) ProxyHostname() string {
+	return c.Hostname(ProxyHostPrefix)
+}
+
+// Hostnames lists the fully qualified names of the proxy and every app,
+// including aliases, in a stable order.
+func (c *Config) Hostnames() []string {
+	names := []string{c.ProxyHostname()}
+	for _, name := range sortedKeys(c.Apps) {
+		app := c.Apps[name]
+		for _, host := range append([]string{app.Host}, app.Aliases...) {
+			// apps may share a hostname below distinct paths
+			if !slices.Contains(names, c.Hostname(host)) {
+				names = append(names, c.Hostname(host))
+			}
+		}
+	}
+	return names
 }
@@ -0,0 +1,396 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultBindAddress   = "127.0.0.1"
+	DefaultHTTPPort      = 80
+	DefaultHTTPSPort     = 443
+	DefaultDashboardPort = 8080
+	DefaultDNSSuffix     = ".locom.self"
+	DefaultProxyEngine   = "traefik"
+	DefaultProxyVersion  = "2.10"
+	DefaultTLSMode       = TLSRedirect
+)
+
+// ProxyVersions lists the proxy engines locom can generate, with their supported versions.
+var ProxyVersions = map[string][]string{
+	"traefik": {"2.10", "2.11", "3.0", "3.1", "3.2", "3.3", "3.4", "3.5"},
+	"caddy":   {"2.7", "2.8", "2.9", "2.10"},
+	"nginx":   {"1.26", "1.27", "1.28", "1.29"},
+}
+
+// DefaultProxyVersions is the version of each engine used when none is set.
+var DefaultProxyVersions = map[string]string{
+	"traefik": DefaultProxyVersion,
+	"caddy":   "2.10",
+	"nginx":   "1.28",
+}
+
+var (
+	// Docker accepts network and container names matching [a-zA-Z0-9][a-zA-Z0-9_.-]*
+	dockerNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	dnsLabelRe   = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+	// Compose project names are lowercase: [a-z0-9][a-z0-9_-]*
+	projectNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	// paths are written verbatim into the rules and files of the proxy
+	pathRe = regexp.MustCompile(`^/[A-Za-z0-9._~%/-]*$`)
+	// header field names are tokens, restricted to the usual characters
+	headerNameRe = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+	// htpasswd separates the user from the hash with a colon
+	htpasswdUserRe = regexp.MustCompile(`^[a-zA-Z0-9_.@-]+$`)
+)
+
+// validate checks the semantics of a decoded config. It reports every problem
+// at once; root is the YAML mapping cfg was decoded from and provides positions.
+func validate(cfg *Config, root *yaml.Node) Errors {
+	v := &validator{root: root}
+	n := cfg.Stage.Network
+
+	if n.Name == "" {
+		v.add("stage.network.name", "is required")
+	} else if !dockerNameRe.MatchString(n.Name) {
+		v.addf("stage.network.name", "%q is not a valid Docker network name (allowed: [a-zA-Z0-9][a-zA-Z0-9_.-]*)", n.Name)
+	}
+
+	if cfg.Stage.Name != "" && !projectNameRe.MatchString(cfg.Stage.Name) {
+		v.addf("stage.name", "%q is not a valid compose project name (allowed: [a-z0-9][a-z0-9_-]*)", cfg.Stage.Name)
+	}
+
+	if net.ParseIP(n.Bind.Address) == nil {
+		v.addf("stage.network.bind.address", "%q is not a valid IP address", n.Bind.Address)
+	}
+	v.ports(n.Bind.Ports)
+
+	if err := checkSuffix(n.DNS.Suffix); err != "" {
+		v.add("stage.network.dns.suffix", err)
+	}
+
+	if !dockerNameRe.MatchString(n.Proxy.Name) {
+		v.addf("stage.network.proxy.name", "%q is not a valid container name", n.Proxy.Name)
+	}
+	if versions, ok := ProxyVersions[n.Proxy.Type.Engine]; !ok {
+		v.addf("stage.network.proxy.type.engine", "unsupported proxy engine %q (supported: %s)",
+			n.Proxy.Type.Engine, strings.Join(sortedKeys(ProxyVersions), ", "))
+	} else if !slices.Contains(versions, n.Proxy.Type.Version) {
+		v.addf("stage.network.proxy.type.version", "unsupported %s version %q (supported: %s)",
+			n.Proxy.Type.Engine, n.Proxy.Type.Version, strings.Join(versions, ", "))
+	}
+	if !slices.Contains(TLSModes, n.Proxy.TLS) {
+		v.addf("stage.network.proxy.tls", "unsupported TLS mode %q (supported: %s)", n.Proxy.TLS, joinModes(TLSModes))
+	}
+	if user := n.Proxy.Dashboard.User; user != "" && !htpasswdUserRe.MatchString(user) {
+		v.addf("stage.network.proxy.dashboard.user", "%q is not a valid user name (allowed: %s)", user, htpasswdUserRe)
+	} else if user != "" && n.Proxy.Type.Engine != "traefik" {
+		v.addf("stage.network.proxy.dashboard.user", "only the traefik engine has a dashboard, %s has none", n.Proxy.Type.Engine)
+	}
+
+	hosts := map[string]string{ProxyHostPrefix: "the proxy"}
+	for _, name := range sortedKeys(cfg.Apps) {
+		v.app(name, cfg.Apps[name], n.Proxy, hosts)
+	}
+	v.entryPoints(cfg)
+
+	return v.errs
+}
+
+func (v *validator) ports(p Ports) {
+	used := map[int]string{}
+	for _, port := range []struct {
+		key   string
+		value int
+	}{{"http", p.HTTP}, {"https", p.HTTPS}, {"dashboard", p.Dashboard}} {
+		path := "stage.network.bind.ports." + port.key
+		if port.value < 1 || port.value > 65535 {
+			v.addf(path, "%d is not a valid port (1-65535)", port.value)
+			continue
+		}
+		if other, ok := used[port.value]; ok {
+			v.addf(path, "port %d is already used by %s", port.value, other)
+			continue
+		}
+		used[port.value] = port.key
+	}
+}
+
+func (v *validator) app(name string, app App, proxy Proxy, hosts map[string]string) {
+	path := "apps." + name
+	if !dnsLabelRe.MatchString(name) {
+		v.addf(path, "app name %q must be a lowercase DNS label (a-z, 0-9, -)", name)
+	} else if name == proxy.Name || name == proxy.Name+"-secure" {
+		// app routers are named after the app, next to the proxy's own
+		v.addf(path, "app name %q clashes with the router of proxy %q", name, proxy.Name)
+	}
+	if !filepath.IsLocal(filepath.FromSlash(app.Dir)) {
+		// overrides are written into the folder
+		v.addf(path+".dir", "%q must be a folder inside the stage root", app.Dir)
+	}
+	if !dockerNameRe.MatchString(app.Service) {
+		v.addf(path+".service", "%q is not a valid compose service name", app.Service)
+	}
+	if app.Port < 1 || app.Port > 65535 {
+		if app.Port == 0 {
+			v.add(path+".port", "is required")
+		} else {
+			v.addf(path+".port", "%d is not a valid port (1-65535)", app.Port)
+		}
+	}
+	if app.Path != "" && !strings.HasPrefix(app.Path, "/") {
+		v.addf(path+".path", "%q must start with /", app.Path)
+	} else if app.Path != "" && !pathRe.MatchString(app.Path) {
+		v.addf(path+".path", "%q may only contain letters, digits and . _ ~ %% - /", app.Path)
+	}
+	switch {
+	case !slices.Contains(Protocols, app.Protocol):
+		v.addf(path+".protocol", "unsupported protocol %q (supported: %s)", app.Protocol, strings.Join(Protocols, ", "))
+	case app.HTTP():
+		if !app.TLSEnabled() && !proxy.TLS.HTTP() {
+			v.addf(path+".tls", "is false but stage.network.proxy.tls is %q: the app would not be reachable", proxy.TLS)
+		}
+		if app.EntryPoint != 0 {
+			v.add(path+".entrypoint", "only tcp and udp apps have an entrypoint, http apps use the proxy's")
+		}
+		if app.Passthrough {
+			v.add(path+".passthrough", "only tcp apps pass TLS through")
+		}
+		if app.Strip && app.Path == "" {
+			v.add(path+".strip", "is set but path is empty: there is no prefix to strip")
+		}
+		v.headers(path+".headers", app.Headers, proxy)
+		if proxy.Type.Engine == "traefik" && (app.Host == ProxyHostPrefix || slices.Contains(app.Aliases, ProxyHostPrefix)) {
+			v.dashboardPath(path+".path", app.Path)
+		}
+	default:
+		v.stream(path, app, proxy)
+	}
+
+	claim := routeClaim(app)
+	v.host(path+".host", app.Host, claim, "app "+name, hosts)
+	for i, alias := range app.Aliases {
+		v.host(fmt.Sprintf("%s.aliases[%d]", path, i), alias, claim, "app "+name, hosts)
+	}
+}
+
+// headers checks the header matchers of an http app.
+func (v *validator) headers(path string, headers map[string]string, proxy Proxy) {
+	if len(headers) > 0 && proxy.Type.Engine != "traefik" {
+		v.addf(path, "header matchers need the traefik engine, %s routes by hostname and path only", proxy.Type.Engine)
+		return
+	}
+	for _, key := range sortedKeys(headers) {
+		if !headerNameRe.MatchString(key) {
+			v.addf(path, "%q is not a valid header name", key)
+		} else if strings.ContainsAny(headers[key], "`\r\n") {
+			v.addf(path+"."+key, "%q may not contain backquotes or line breaks", headers[key])
+		}
+	}
+}
+
+// traefikDashboardPaths are the paths the Traefik dashboard is served below
+// on the proxy hostname.
+var traefikDashboardPaths = []string{"/api", "/dashboard"}
+
+// dashboardPath checks that an app mounted on the proxy hostname leaves the
+// paths of the Traefik dashboard to it.
+func (v *validator) dashboardPath(path, prefix string) {
+	for _, reserved := range traefikDashboardPaths {
+		if prefix != "" && (strings.HasPrefix(reserved, prefix) || strings.HasPrefix(prefix, reserved)) {
+			v.addf(path, "%q overlaps %s, which the traefik dashboard uses on the proxy hostname", prefix, reserved)
+			return
+		}
+	}
+}
+
+// routeClaim describes what an app routes of its hostnames: http requests
+// below its path carrying its headers, or tcp and udp connections. Apps may
+// share a hostname with distinct claims.
+func routeClaim(app App) string {
+	if !app.HTTP() {
+		return " for " + app.Protocol
+	}
+	var claim string
+	if app.Path != "" {
+		claim += " below " + app.Path
+	}
+	for _, key := range sortedKeys(app.Headers) {
+		claim += fmt.Sprintf(" with %s: %s", key, app.Headers[key])
+	}
+	return claim
+}
+
+// stream checks a tcp or udp app, routed on its own entrypoint.
+func (v *validator) stream(path string, app App, proxy Proxy) {
+	if proxy.Type.Engine != "traefik" {
+		v.addf(path+".protocol", "%s apps need the traefik engine, %s routes http only", app.Protocol, proxy.Type.Engine)
+	}
+	if app.Path != "" {
+		v.add(path+".path", "only http apps are routed by path")
+	}
+	if app.EntryPoint < 1 || app.EntryPoint > 65535 {
+		if app.EntryPoint == 0 {
+			v.addf(path+".entrypoint", "is required for %s apps", app.Protocol)
+		} else {
+			v.addf(path+".entrypoint", "%d is not a valid port (1-65535)", app.EntryPoint)
+		}
+	}
+	if app.Protocol == ProtocolUDP {
+		if app.Passthrough {
+			v.add(path+".passthrough", "only tcp apps pass TLS through")
+		}
+		return
+	}
+	switch {
+	case app.Passthrough && !app.TLSEnabled():
+		v.add(path+".passthrough", "is set but tls is false: there is no TLS to pass through")
+	case app.TLSEnabled() && !app.Passthrough && !proxy.TLS.HTTPS():
+		v.addf(path+".tls", "terminating TLS needs the stage certificate, but stage.network.proxy.tls is %q: set passthrough, or tls to false", proxy.TLS)
+	}
+}
+
+// entryPoints checks that tcp and udp apps listen on ports of their own:
+// only tcp apps with tls, told apart by SNI, may share one.
+func (v *validator) entryPoints(cfg *Config) {
+	ports := cfg.Stage.Network.Bind.Ports
+	proxy := map[int]string{
+		80:              "the proxy's http entrypoint",
+		443:             "the proxy's https entrypoint",
+		8080:            "the proxy's API",
+		ports.HTTP:      "stage.network.bind.ports.http",
+		ports.HTTPS:     "stage.network.bind.ports.https",
+		ports.Dashboard: "stage.network.bind.ports.dashboard",
+	}
+	used := map[string]string{}
+	for _, name := range sortedKeys(cfg.Apps) {
+		app := cfg.Apps[name]
+		if app.HTTP() || app.EntryPoint == 0 {
+			continue
+		}
+		path := "apps." + name + ".entrypoint"
+		if owner, ok := proxy[app.EntryPoint]; ok {
+			v.addf(path, "port %d is already used by %s", app.EntryPoint, owner)
+			continue
+		}
+		sni := app.Protocol == ProtocolTCP && app.TLSEnabled()
+		key := fmt.Sprintf("%d/%s", app.EntryPoint, app.Protocol)
+		if other, ok := used[key]; ok {
+			if o := cfg.Apps[other]; !sni || !o.TLSEnabled() {
+				v.addf(path, "%s port %d is already used by app %s; only tcp apps with tls share entrypoints", app.Protocol, app.EntryPoint, other)
+			}
+			continue
+		}
+		used[key] = name
+	}
+}
+
+// host checks a hostname prefix and that no two apps make the same claim on
+// it, see routeClaim.
+func (v *validator) host(path, host, claim, owner string, hosts map[string]string) {
+	if err := checkHost(host); err != "" {
+		v.addf(path, "%q %s", host, err)
+		return
+	}
+	if other, ok := hosts[host+claim]; ok && other != owner {
+		v.addf(path, "hostname %q%s is already used by %s", host, claim, other)
+		return
+	}
+	hosts[host+claim] = owner
+}
+
+func checkSuffix(suffix string) string {
+	if !strings.HasPrefix(suffix, ".") {
+		return fmt.Sprintf("%q must start with a dot, e.g. .locom.self", suffix)
+	}
+	if len(suffix) > 253 {
+		return "is longer than 253 characters"
+	}
+	if err := checkHost(suffix[1:]); err != "" {
+		return fmt.Sprintf("%q %s", suffix, err)
+	}
+	return ""
+}
+
+func checkHost(host string) string {
+	if host == "" {
+		return "is not a valid domain: empty"
+	}
+	for _, label := range strings.Split(host, ".") {
+		if !dnsLabelRe.MatchString(label) {
+			return fmt.Sprintf("is not a valid domain: label %q must be 1-63 lowercase letters, digits or hyphens", label)
+		}
+	}
+	return ""
+}
+
+type validator struct {
+	root *yaml.Node
+	errs Errors
+}
+
+func (v *validator) addf(path, format string, args ...any) {
+	v.add(path, fmt.Sprintf(format, args...))
+}
+
+func (v *validator) add(path, msg string) {
+	v.errs = append(v.errs, nodeError(locate(v.root, path), path, msg))
+}
+
+// locate returns the node at the dotted path, or the deepest existing
+// ancestor when the value is missing (e.g. left to its default).
+func locate(root *yaml.Node, path string) *yaml.Node {
+	n := root
+	for _, key := range splitPath(path) {
+		next := child(n, key)
+		if next == nil {
+			return n
+		}
+		n = next
+	}
+	return n
+}
+
+func child(n *yaml.Node, key string) *yaml.Node {
+	if n == nil {
+		return nil
+	}
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				return n.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		var idx int
+		if _, err := fmt.Sscanf(key, "%d", &idx); err == nil && idx >= 0 && idx < len(n.Content) {
+			return n.Content[idx]
+		}
+	}
+	return nil
+}
+
+// splitPath turns a.b[0].c into [a b 0 c].
+func splitPath(path string) []string {
+	path = strings.ReplaceAll(path, "[", ".")
+	path = strings.ReplaceAll(path, "]", "")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+func joinModes(modes []TLSMode) string {
+	s := make([]string, len(modes))
+	for i, m := range modes {
+		s[i] = string(m)
+	}
+	return strings.Join(s, ", ")
+}
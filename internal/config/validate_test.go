@@ -0,0 +1,339 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/localcompose/locom/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func loadString(t *testing.T, yamlData string) (*config.Config, error) {
+	t.Helper()
+	tmpFile := filepath.Join(t.TempDir(), "locom.yml")
+	require.NoError(t, os.WriteFile(tmpFile, []byte(yamlData), 0644))
+	return config.LoadConfig(tmpFile)
+}
+
+func TestValidate_Defaults(t *testing.T) {
+	cfg, err := loadString(t, `
+stage:
+  network:
+    name: testnet
+`)
+	require.NoError(t, err)
+	require.Equal(t, config.DefaultBindAddress, cfg.Stage.Network.Bind.Address)
+	require.Equal(t, config.DefaultDNSSuffix, cfg.Stage.Network.DNS.Suffix)
+	require.Equal(t, config.DefaultProxyEngine, cfg.Stage.Network.Proxy.Type.Engine)
+	require.Equal(t, config.DefaultProxyVersion, cfg.Stage.Network.Proxy.Type.Version)
+	require.Equal(t, config.TLSRedirect, cfg.Stage.Network.Proxy.TLS)
+}
+
+func TestValidate_TLSMode(t *testing.T) {
+	cfg, err := loadString(t, `
+stage:
+  network:
+    name: testnet
+    proxy:
+      tls: http
+`)
+	require.NoError(t, err)
+	require.False(t, cfg.Stage.Network.Proxy.TLS.HTTPS())
+
+	_, err = loadString(t, `
+stage:
+  network:
+    name: testnet
+    proxy:
+      tls: tls
+`)
+	var errs config.Errors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 1)
+	require.Equal(t, "stage.network.proxy.tls", errs[0].Path)
+	require.Equal(t, 6, errs[0].Line)
+	require.Contains(t, errs[0].Msg, `unsupported TLS mode "tls"`)
+}
+
+func TestValidate_CaddyEngine(t *testing.T) {
+	cfg, err := loadString(t, `
+stage:
+  network:
+    name: testnet
+    proxy:
+      type:
+        engine: caddy
+`)
+	require.NoError(t, err)
+	require.Equal(t, "caddy", cfg.Stage.Network.Proxy.Name)
+	require.Equal(t, config.DefaultProxyVersions["caddy"], cfg.Stage.Network.Proxy.Type.Version)
+
+	_, err = loadString(t, `
+stage:
+  network:
+    name: testnet
+    proxy:
+      type:
+        engine: caddy
+      dashboard:
+        user: admin
+`)
+	var errs config.Errors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 1)
+	require.Equal(t, "stage.network.proxy.dashboard.user", errs[0].Path)
+	require.Contains(t, errs[0].Msg, "only the traefik engine has a dashboard")
+}
+
+func TestValidate_StreamApps(t *testing.T) {
+	cfg, err := loadString(t, `
+stage:
+  network:
+    name: testnet
+apps:
+  db:
+    port: 5432
+    protocol: tcp
+    entrypoint: 5432
+  cache:
+    port: 6379
+    protocol: tcp
+    entrypoint: 5432
+    passthrough: true
+  dns:
+    port: 53
+    protocol: udp
+    entrypoint: 5353
+  web:
+    port: 80
+`)
+	require.NoError(t, err)
+	require.Equal(t, config.ProtocolHTTP, cfg.Apps["web"].Protocol)
+	require.True(t, cfg.Apps["web"].HTTP())
+	require.False(t, cfg.Apps["db"].HTTP())
+
+	_, err = loadString(t, `
+stage:
+  network:
+    name: testnet
+    proxy:
+      tls: http
+apps:
+  db:
+    port: 5432
+    protocol: tcp
+    entrypoint: 5432
+  redis:
+    port: 6379
+    protocol: tcp
+    entrypoint: 5432
+    tls: false
+  mqtt:
+    port: 1883
+    protocol: udp
+  admin:
+    port: 80
+    protocol: sctp
+  web:
+    port: 80
+    entrypoint: 8443
+  dash:
+    port: 80
+    protocol: tcp
+    entrypoint: 8080
+    tls: false
+`)
+	var errs config.Errors
+	require.ErrorAs(t, err, &errs)
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Path+": "+e.Msg)
+	}
+	require.ElementsMatch(t, []string{
+		`apps.admin.protocol: unsupported protocol "sctp" (supported: http, tcp, udp)`,
+		`apps.db.tls: terminating TLS needs the stage certificate, but stage.network.proxy.tls is "http": set passthrough, or tls to false`,
+		`apps.mqtt.entrypoint: is required for udp apps`,
+		`apps.web.entrypoint: only tcp and udp apps have an entrypoint, http apps use the proxy's`,
+		`apps.redis.entrypoint: tcp port 5432 is already used by app db; only tcp apps with tls share entrypoints`,
+		`apps.dash.entrypoint: port 8080 is already used by stage.network.bind.ports.dashboard`,
+	}, got)
+
+	_, err = loadString(t, `
+stage:
+  network:
+    name: testnet
+    proxy:
+      type:
+        engine: caddy
+apps:
+  db:
+    port: 5432
+    protocol: tcp
+    entrypoint: 5432
+`)
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0].Msg, "tcp apps need the traefik engine")
+}
+
+func TestValidate_ReportsAllProblems(t *testing.T) {
+	_, err := loadString(t, `stage:
+  network:
+    name: -bad
+    bind:
+      address: 127.0.0.300
+    dns:
+      suffix: locom.self
+    proxy:
+      type:
+        engine: traefik
+        version: 1.7
+apps:
+  web:
+    port: 80
+  api:
+    host: web
+    port: 70000
+    path: api
+  blog:
+    host: web
+    port: 80
+    dir: ../blog
+`)
+	require.Error(t, err)
+
+	var errs config.Errors
+	require.ErrorAs(t, err, &errs)
+
+	got := map[string]int{}
+	for _, e := range errs {
+		got[e.Path] = e.Line
+	}
+	require.Equal(t, map[string]int{
+		"stage.network.name":               3,
+		"stage.network.bind.address":       5,
+		"stage.network.dns.suffix":         7,
+		"stage.network.proxy.type.version": 11,
+		"apps.api.port":                    17,
+		"apps.api.path":                    18,
+		"apps.web.host":                    14,
+		"apps.blog.dir":                    22,
+	}, got)
+}
+
+func TestValidate_SharedHosts(t *testing.T) {
+	cfg, err := loadString(t, `
+stage:
+  network:
+    name: testnet
+apps:
+  web:
+    port: 80
+    aliases: [www]
+  api:
+    host: web
+    port: 8000
+    path: /api
+    strip: true
+  beta:
+    host: www
+    port: 80
+    headers:
+      X-Channel: beta
+  hooks:
+    host: proxy
+    port: 9000
+    path: /hooks
+`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"proxy.locom.self", "web.locom.self", "www.locom.self"}, cfg.Hostnames())
+
+	_, err = loadString(t, `
+stage:
+  network:
+    name: testnet
+apps:
+  web:
+    port: 80
+    path: /api
+  api:
+    host: web
+    port: 8000
+    path: /api
+  blog:
+    port: 80
+    strip: true
+    headers:
+      X Channel: beta
+      X-Ref: "a`+"`"+`b"
+  dash:
+    host: proxy
+    port: 80
+    path: /api/v2
+  files:
+    port: 80
+    path: /files?raw
+`)
+	var errs config.Errors
+	require.ErrorAs(t, err, &errs)
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Path+": "+e.Msg)
+	}
+	require.ElementsMatch(t, []string{
+		`apps.web.host: hostname "web" below /api is already used by app api`,
+		`apps.blog.strip: is set but path is empty: there is no prefix to strip`,
+		`apps.blog.headers: "X Channel" is not a valid header name`,
+		"apps.blog.headers.X-Ref: \"a`b\" may not contain backquotes or line breaks",
+		`apps.dash.path: "/api/v2" overlaps /api, which the traefik dashboard uses on the proxy hostname`,
+		`apps.files.path: "/files?raw" may only contain letters, digits and . _ ~ % - /`,
+	}, got)
+
+	_, err = loadString(t, `
+stage:
+  network:
+    name: testnet
+    proxy:
+      type:
+        engine: nginx
+apps:
+  web:
+    port: 80
+    headers:
+      X-Channel: beta
+  dash:
+    host: proxy
+    port: 80
+    path: /api
+`)
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 1)
+	require.Equal(t, "apps.web.headers", errs[0].Path)
+	require.Contains(t, errs[0].Msg, "header matchers need the traefik engine")
+}
+
+func TestValidate_DuplicateApps(t *testing.T) {
+	_, err := loadString(t, `stage:
+  network:
+    name: testnet
+apps:
+  web:
+    port: 80
+  web:
+    port: 81
+`)
+	var errs config.Errors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 1)
+	require.Equal(t, 7, errs[0].Line)
+	require.Contains(t, errs[0].Msg, `duplicate key "web" (first defined at line 5)`)
+}
+
+func TestValidate_SyntaxError(t *testing.T) {
+	_, err := loadString(t, "stage:\n  network: [\n")
+	var errs config.Errors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 1)
+	require.Positive(t, errs[0].Line)
+}
@@ -0,0 +1,140 @@
+// Package diff renders line differences between two texts as a unified diff.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// context is the number of unchanged lines shown around a change.
+const context = 3
+
+// Op is a line of an edit script: kept (' '), removed ('-') or added ('+').
+type Op struct {
+	Kind byte
+	Line string
+}
+
+// Unified returns the unified diff turning a, named oldName, into b, named
+// newName, or "" when they are equal.
+func Unified(oldName, newName string, a, b []byte) string {
+	if string(a) == string(b) {
+		return ""
+	}
+	ops := Lines(split(a), split(b), nil)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for start := 0; start < len(ops); {
+		// find the next change and the end of its hunk
+		first := start
+		for first < len(ops) && ops[first].Kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		last, gap := first, 0
+		for i := first; i < len(ops) && gap <= 2*context; i++ {
+			if ops[i].Kind == ' ' {
+				gap++
+			} else {
+				last, gap = i, 0
+			}
+		}
+		from, to := max(first-context, start), min(last+context+1, len(ops))
+
+		oldLine, newLine := 1, 1
+		for _, o := range ops[:from] {
+			if o.Kind != '+' {
+				oldLine++
+			}
+			if o.Kind != '-' {
+				newLine++
+			}
+		}
+		var oldCount, newCount int
+		for _, o := range ops[from:to] {
+			if o.Kind != '+' {
+				oldCount++
+			}
+			if o.Kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount))
+		for _, o := range ops[from:to] {
+			out.WriteByte(o.Kind)
+			out.WriteString(o.Line)
+			out.WriteByte('\n')
+		}
+		start = to
+	}
+	return out.String()
+}
+
+func hunkRange(line, count int) string {
+	if count == 0 {
+		// an empty range names the line before it
+		line--
+	}
+	if count == 1 {
+		return fmt.Sprint(line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+func split(data []byte) []string {
+	s := strings.TrimSuffix(string(data), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// Lines computes the edit script from a to b along a longest common
+// subsequence, which is cheap enough for the files locom handles. Lines are
+// the same when equal says so, or when identical if equal is nil; kept lines
+// are those of a.
+func Lines(a, b []string, equal func(x, y string) bool) []Op {
+	if equal == nil {
+		equal = func(x, y string) bool { return x == y }
+	}
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if equal(a[i], b[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []Op
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case equal(a[i], b[j]):
+			ops = append(ops, Op{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, Op{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, Op{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, Op{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, Op{'+', b[j]})
+	}
+	return ops
+}
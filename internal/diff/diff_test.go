@@ -0,0 +1,45 @@
+package diff_test
+
+import (
+	"testing"
+
+	"github.com/localcompose/locom/internal/diff"
+)
+
+func TestUnified(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n17\n18\n19\n20\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n18\n19\n20\n21\n"
+
+	want := `--- old
++++ new
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -14,7 +14,7 @@
+ 14
+ 15
+ 16
+-17
+ 18
+ 19
+ 20
++21
+`
+	if got := diff.Unified("old", "new", []byte(a), []byte(b)); got != want {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := diff.Unified("old", "new", []byte(a), []byte(a)); got != "" {
+		t.Errorf("expected no diff for equal texts, got:\n%s", got)
+	}
+
+	want = "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n"
+	if got := diff.Unified("old", "new", nil, []byte("a\nb\n")); got != want {
+		t.Errorf("unexpected diff from an empty text:\n%s", got)
+	}
+}
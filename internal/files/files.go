@@ -0,0 +1,67 @@
+// Package files writes the files locom generates, to disk or, for a dry run,
+// as a preview of the changes.
+package files
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/localcompose/locom/internal/diff"
+)
+
+// Writer writes generated files.
+type Writer interface {
+	// WriteFile writes data to path, creating its folder. perm applies to
+	// new files.
+	WriteFile(path string, data []byte, perm os.FileMode) error
+	// DryRun reports whether nothing is actually written, for steps that
+	// cannot go through WriteFile.
+	DryRun() bool
+}
+
+// Disk writes files to disk.
+type Disk struct{}
+
+func (Disk) WriteFile(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, perm)
+}
+
+func (Disk) DryRun() bool {
+	return false
+}
+
+// Preview writes nothing and prints to Out the unified diff of every file
+// that would be created or modified. The contents of private files, those
+// only their owner may read such as keys and password hashes, are not shown.
+type Preview struct {
+	Out io.Writer
+}
+
+func (p Preview) WriteFile(path string, data []byte, perm os.FileMode) error {
+	current, err := os.ReadFile(path)
+	oldName := path
+	if os.IsNotExist(err) {
+		oldName = os.DevNull
+	} else if err != nil {
+		return err
+	}
+	if string(current) == string(data) {
+		fmt.Fprintf(p.Out, "✅ %s is up to date\n", path)
+		return nil
+	}
+	if perm&0o077 == 0 {
+		fmt.Fprintf(p.Out, "--- %s\n+++ %s\n# private file (mode %04o), contents not shown\n", oldName, path, perm)
+		return nil
+	}
+	fmt.Fprint(p.Out, diff.Unified(oldName, path, current, data))
+	return nil
+}
+
+func (Preview) DryRun() bool {
+	return true
+}
@@ -0,0 +1,72 @@
+package files_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/localcompose/locom/internal/files"
+)
+
+func TestDisk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a", "b.yml")
+	if err := (files.Disk{}).WriteFile(path, []byte("x: 1\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("expected the file and its folder to be created: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected mode 0600, got %v", info.Mode().Perm())
+	}
+}
+
+func TestPreview(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.yml")
+	if err := os.WriteFile(existing, []byte("a: 1\nb: 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	w := files.Preview{Out: &out}
+	if !w.DryRun() {
+		t.Error("expected a dry run")
+	}
+	writes := []struct {
+		name string
+		data string
+		perm os.FileMode
+	}{
+		{"existing.yml", "a: 1\nb: 3\n", 0o644},
+		{"new.yml", "c: 1\n", 0o644},
+		{"secret.key", "KEY\n", 0o600},
+		{"existing.yml", "a: 1\nb: 2\n", 0o644},
+	}
+	for _, wr := range writes {
+		if err := w.WriteFile(filepath.Join(dir, wr.name), []byte(wr.data), wr.perm); err != nil {
+			t.Fatalf("WriteFile(%s) failed: %v", wr.name, err)
+		}
+	}
+
+	want := strings.Join([]string{
+		"--- " + existing, "+++ " + existing, "@@ -1,2 +1,2 @@", " a: 1", "-b: 2", "+b: 3",
+		"--- " + os.DevNull, "+++ " + filepath.Join(dir, "new.yml"), "@@ -0,0 +1 @@", "+c: 1",
+		"--- " + os.DevNull, "+++ " + filepath.Join(dir, "secret.key"), "# private file (mode 0600), contents not shown",
+		"✅ " + existing + " is up to date",
+	}, "\n") + "\n"
+	if out.String() != want {
+		t.Errorf("unexpected preview:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	if data, _ := os.ReadFile(existing); string(data) != "a: 1\nb: 2\n" {
+		t.Errorf("expected the file to be left alone, got %q", data)
+	}
+	for _, name := range []string{"new.yml", "secret.key"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s not to be created", name)
+		}
+	}
+}
@@ -7,56 +7,38 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
-	"gopkg.in/yaml.v3"
+	"github.com/localcompose/locom/internal/config"
+	"github.com/localcompose/locom/internal/files"
+	"github.com/localcompose/locom/internal/stage"
 )
 
-func Setup(verify bool) error {
-	configPath := ".locom/locom.yml"
+// Setup writes the hostnames of the stage at root into the system hosts file.
+// A dry run of w previews the change and skips the verification.
+func Setup(w files.Writer, root string, profiles []string, verify bool) error {
+	configPath := stage.ConfigPath(root)
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		return errors.New("this folder does not contain locom stage configuration")
 	}
 
-	// Read YAML
-	content, err := os.ReadFile(configPath)
+	cfg, err := config.Load(configPath, profiles...)
 	if err != nil {
-		return fmt.Errorf("reading locom.yml: %w", err)
+		return fmt.Errorf("loading config: %w", err)
 	}
 
-	var parsed struct {
-		Stage struct {
-			Network struct {
-				Bind struct {
-					Address string `yaml:"address"`
-				} `yaml:"bind"`
-				DNS struct {
-					Suffix string `yaml:"suffix"`
-				} `yaml:"dns"`
-			} `yaml:"network"`
-		} `yaml:"stage"`
-	}
-	if err := yaml.Unmarshal(content, &parsed); err != nil {
-		return fmt.Errorf("parsing YAML: %w", err)
-	}
-
-	address := parsed.Stage.Network.Bind.Address
-	suffix := parsed.Stage.Network.DNS.Suffix
-	if address == "" || suffix == "" {
-		return errors.New("missing required fields in locom.yml (stage.network.bind.address or stage.network.dns.suffix)")
-	}
+	address := cfg.Stage.Network.Bind.Address
+	proxyHost := cfg.ProxyHostname()
 
-	cwd, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("getting current dir: %w", err)
-	}
-	stageName := filepath.Base(cwd)
+	stageName := filepath.Base(root)
 
 	beginMarker := fmt.Sprintf("# >>> locom %s loopback apps >>>", stageName)
 	endMarker := fmt.Sprintf("# <<< locom %s loopback apps <<<", stageName)
-	entry := fmt.Sprintf("%s proxy%s", address, suffix)
+	entries := hostEntries(cfg)
 
 	hostsPath := getHostsPath()
 	hostsContent, err := os.ReadFile(hostsPath)
@@ -86,28 +68,39 @@ func Setup(verify bool) error {
 		}
 	}
 
-	newLines = append(newLines,
-		beginMarker,
-		entry,
-		endMarker,
-	)
+	newLines = append(newLines, beginMarker)
+	newLines = append(newLines, entries...)
+	newLines = append(newLines, endMarker)
 
 	updated := strings.Join(newLines, sep) + sep
 
-	if err := updateHosts(updated, hostsPath); err != nil {
+	if w.DryRun() {
+		// the system file may need elevated rights to write, not to preview
+		err = w.WriteFile(hostsPath, []byte(updated), 0644)
+	} else {
+		err = updateHosts(updated, hostsPath)
+	}
+	if err != nil {
 		return err
 	}
 
-	statePath := ".locom/hosts"
-	if err := os.WriteFile(statePath, []byte(fmt.Sprintf("%s\n%s\n%s\n", beginMarker, entry, endMarker)), 0644); err != nil {
+	statePath := filepath.Join(root, stage.LocomDir, "hosts")
+	if err := w.WriteFile(statePath, []byte(fmt.Sprintf("%s\n%s\n%s\n", beginMarker, strings.Join(entries, "\n"), endMarker)), 0644); err != nil {
 		return fmt.Errorf("writing state to .locom/hosts: %w", err)
 	}
+	if w.DryRun() {
+		return nil
+	}
 
 	fmt.Println("✅ Hosts file updated with locom stage entries.")
 
 	if verify {
-		fqdn := "proxy" + suffix
-		if err := verifyHost(address, fqdn); err != nil {
+		// probe the port the proxy actually listens on in its TLS mode
+		port := cfg.Stage.Network.Bind.Ports.HTTP
+		if !cfg.Stage.Network.Proxy.TLS.HTTP() {
+			port = cfg.Stage.Network.Bind.Ports.HTTPS
+		}
+		if err := verifyHost(address, proxyHost, port); err != nil {
 			return fmt.Errorf("verification failed: %w", err)
 		}
 	}
@@ -115,6 +108,37 @@ func Setup(verify bool) error {
 	return nil
 }
 
+// hostEntries has one line per hostname: the proxy and every app with its aliases.
+func hostEntries(cfg *config.Config) []string {
+	var entries []string
+	for _, host := range cfg.Hostnames() {
+		entries = append(entries, fmt.Sprintf("%s %s", cfg.Stage.Network.Bind.Address, host))
+	}
+	return entries
+}
+
+// Outdated reports whether the hosts file was set up for the stage at root
+// and lacks some of its current hostnames, e.g. after adding an app.
+func Outdated(root string, profiles []string) (bool, error) {
+	state, err := os.ReadFile(filepath.Join(root, stage.LocomDir, "hosts"))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	cfg, err := config.Load(stage.ConfigPath(root), profiles...)
+	if err != nil {
+		return false, fmt.Errorf("loading config: %w", err)
+	}
+	lines := strings.Split(string(state), "\n")
+	for _, entry := range hostEntries(cfg) {
+		if !slices.Contains(lines, entry) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func copyFile(srcPath, dstPath string) error {
 	src, err := os.Open(srcPath)
 	if err != nil {
@@ -134,7 +158,7 @@ func copyFile(srcPath, dstPath string) error {
 	return nil
 }
 
-func verifyHost(expectedAddr, fqdn string) error {
+func verifyHost(expectedAddr, fqdn string, port int) error {
 	fmt.Printf("🔍 Verifying DNS resolution for %s...\n", fqdn)
 
 	ips, err := net.LookupHost(fqdn)
@@ -156,7 +180,7 @@ func verifyHost(expectedAddr, fqdn string) error {
 	fmt.Printf("✅ DNS resolution successful: %s → %s\n", fqdn, expectedAddr)
 
 	// Optional: attempt TCP connection to verify routing
-	addr := net.JoinHostPort(fqdn, "80")
+	addr := net.JoinHostPort(fqdn, strconv.Itoa(port))
 	conn, err := net.DialTimeout("tcp", addr, 1*time.Second)
 	if conn != nil {
 		defer conn.Close()
@@ -164,7 +188,7 @@ func verifyHost(expectedAddr, fqdn string) error {
 	if err != nil {
 		if opErr, ok := err.(*net.OpError); ok {
 			if errors.Is(opErr.Err, syscall.ECONNREFUSED) {
-				fmt.Printf("⚠️ TCP Connection to %s at port 80 refused (no service), but DNS resolution succeeded.\n", addr)
+				fmt.Printf("⚠️ TCP Connection to %s refused (no service), but DNS resolution succeeded.\n", addr)
 				return nil
 			}
 		}
@@ -0,0 +1,130 @@
+// Package htpasswd writes Apache htpasswd files as read by Traefik's
+// basic-auth middleware, hashing passwords with the apr1 (MD5) scheme.
+package htpasswd
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/localcompose/locom/internal/files"
+)
+
+const (
+	apr1Magic = "$apr1$"
+	itoa64    = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// Hash hashes password with apr1 and a random salt.
+func Hash(password string) (string, error) {
+	salt, err := randomString(8)
+	if err != nil {
+		return "", err
+	}
+	return apr1(password, salt), nil
+}
+
+// Password generates a random password of n characters.
+func Password(n int) (string, error) {
+	return randomString(n)
+}
+
+// Write stores a single user entry at path, readable by its owner only.
+func Write(w files.Writer, path, user, password string) error {
+	if user == "" || strings.ContainsAny(user, ":\n") {
+		return fmt.Errorf("invalid user name %q", user)
+	}
+	hash, err := Hash(password)
+	if err != nil {
+		return err
+	}
+	if err := w.WriteFile(path, []byte(user+":"+hash+"\n"), 0o600); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// User returns the user name of the first entry in the htpasswd file at path.
+func User(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	user, _, ok := strings.Cut(string(data), ":")
+	if !ok {
+		return "", fmt.Errorf("%s: no htpasswd entry", path)
+	}
+	return user, nil
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating random bytes: %w", err)
+	}
+	for i := range b {
+		b[i] = itoa64[int(b[i])%len(itoa64)]
+	}
+	return string(b), nil
+}
+
+// apr1 is Apache's variant of the FreeBSD MD5-crypt algorithm.
+func apr1(password, salt string) string {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alt := md5.Sum([]byte(password + salt + password))
+	ctx := []byte(password + apr1Magic + salt)
+	for i := len(pw); i > 0; i -= 16 {
+		ctx = append(ctx, alt[:min(i, 16)]...)
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			ctx = append(ctx, 0)
+		} else if len(pw) > 0 {
+			ctx = append(ctx, pw[0])
+		}
+	}
+	final := md5.Sum(ctx)
+
+	for i := 0; i < 1000; i++ {
+		var c []byte
+		if i&1 == 1 {
+			c = append(c, pw...)
+		} else {
+			c = append(c, final[:]...)
+		}
+		if i%3 != 0 {
+			c = append(c, salt...)
+		}
+		if i%7 != 0 {
+			c = append(c, pw...)
+		}
+		if i&1 == 1 {
+			c = append(c, final[:]...)
+		} else {
+			c = append(c, pw...)
+		}
+		final = md5.Sum(c)
+	}
+
+	var out strings.Builder
+	out.WriteString(apr1Magic + salt + "$")
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		v := uint(final[g[0]])<<16 | uint(final[g[1]])<<8 | uint(final[g[2]])
+		to64(&out, v, 4)
+	}
+	to64(&out, uint(final[11]), 2)
+	return out.String()
+}
+
+func to64(b *strings.Builder, v uint, n int) {
+	for ; n > 0; n-- {
+		b.WriteByte(itoa64[v&0x3f])
+		v >>= 6
+	}
+}
@@ -0,0 +1,16 @@
+package htpasswd
+
+import "testing"
+
+func TestApr1(t *testing.T) {
+	// reference values from openssl passwd -apr1 -salt <salt> <password>
+	tests := []struct{ password, salt, want string }{
+		{"secret", "r31NxZ7J", "$apr1$r31NxZ7J$q7kK0LA19FefcTzWqh8BJ1"},
+		{"password", "ab", "$apr1$ab$vZXhMKiOqO1yMl8FLQFrs0"},
+	}
+	for _, tt := range tests {
+		if got := apr1(tt.password, tt.salt); got != tt.want {
+			t.Errorf("apr1(%q, %q) = %q, want %q", tt.password, tt.salt, got, tt.want)
+		}
+	}
+}
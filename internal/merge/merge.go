@@ -0,0 +1,223 @@
+// Package merge merges YAML documents three ways: the changes made between a
+// base document and a new version of it are applied to a copy the user
+// edited, keeping the user's own changes, comments and key order.
+package merge
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Conflict is a value both the user and the new version changed differently
+// since the base. Absent values are nil.
+type Conflict struct {
+	Path   string
+	Base   *yaml.Node
+	Ours   *yaml.Node
+	Theirs *yaml.Node
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s: changed to %s, while the template changes %s to %s",
+		c.Path, inline(c.Ours), inline(c.Base), inline(c.Theirs))
+}
+
+// Merge applies the changes from base to theirs onto ours and returns the
+// result; ours is modified. A nil base, for a file with no known origin,
+// turns every difference between ours and theirs into a conflict, except for
+// keys only one of them has. Conflicting values are left as in ours.
+//
+// Mappings are merged key by key. Lists of scalars, such as commands, ports
+// or volumes, are merged item by item: items the new version drops are
+// removed and those it adds are inserted after their predecessor. Other
+// values are replaced as a whole.
+func Merge(base, ours, theirs *yaml.Node) (*yaml.Node, []Conflict) {
+	var m merger
+	result := m.node("", content(base), content(ours), content(theirs))
+	if ours.Kind == yaml.DocumentNode {
+		ours.Content = []*yaml.Node{result}
+		return ours, m.conflicts
+	}
+	return result, m.conflicts
+}
+
+type merger struct {
+	conflicts []Conflict
+}
+
+func (m *merger) conflict(path string, base, ours, theirs *yaml.Node) {
+	m.conflicts = append(m.conflicts, Conflict{Path: path, Base: base, Ours: ours, Theirs: theirs})
+}
+
+func (m *merger) node(path string, base, ours, theirs *yaml.Node) *yaml.Node {
+	switch {
+	case Equal(ours, theirs), base != nil && Equal(base, theirs):
+		return ours
+	case base != nil && Equal(base, ours):
+		// the user's comments stay with the value
+		theirs.HeadComment, theirs.LineComment, theirs.FootComment = ours.HeadComment, ours.LineComment, ours.FootComment
+		return theirs
+	case ours.Kind == yaml.MappingNode && theirs.Kind == yaml.MappingNode && (base == nil || base.Kind == yaml.MappingNode):
+		return m.mapping(path, base, ours, theirs)
+	case base != nil && ours.Kind == yaml.SequenceNode && scalars(base) && scalars(ours) && scalars(theirs):
+		return m.sequence(base, ours, theirs)
+	}
+	m.conflict(path, base, ours, theirs)
+	return ours
+}
+
+func (m *merger) mapping(path string, base, ours, theirs *yaml.Node) *yaml.Node {
+	var merged []*yaml.Node
+	for i := 0; i+1 < len(ours.Content); i += 2 {
+		key, value := ours.Content[i], ours.Content[i+1]
+		keyPath := join(path, key.Value)
+		b, t := lookup(base, key.Value), lookup(theirs, key.Value)
+		switch {
+		case t != nil:
+			merged = append(merged, key, m.node(keyPath, b, value, t))
+		case b == nil:
+			// added by the user
+			merged = append(merged, key, value)
+		case Equal(b, value):
+			// removed by the new version
+		default:
+			m.conflict(keyPath, b, value, nil)
+			merged = append(merged, key, value)
+		}
+	}
+	for i := 0; i+1 < len(theirs.Content); i += 2 {
+		key, value := theirs.Content[i], content(theirs.Content[i+1])
+		if lookup(ours, key.Value) != nil {
+			continue
+		}
+		switch b := lookup(base, key.Value); {
+		case b == nil:
+			// added by the new version
+			merged = append(merged, key, value)
+		case Equal(b, value):
+			// removed by the user
+		default:
+			m.conflict(join(path, key.Value), b, nil, value)
+		}
+	}
+	ours.Content = merged
+	return ours
+}
+
+func (m *merger) sequence(base, ours, theirs *yaml.Node) *yaml.Node {
+	contains := func(items []*yaml.Node, n *yaml.Node) bool {
+		return slices.ContainsFunc(items, func(i *yaml.Node) bool { return Equal(i, n) })
+	}
+	var merged []*yaml.Node
+	for _, item := range ours.Content {
+		if !contains(base.Content, item) || contains(theirs.Content, item) {
+			merged = append(merged, item)
+		}
+	}
+	for i, item := range theirs.Content {
+		if contains(base.Content, item) || contains(merged, item) {
+			continue
+		}
+		at := len(merged)
+		if i == 0 {
+			at = 0
+		} else if prev := slices.IndexFunc(merged, func(n *yaml.Node) bool { return Equal(n, theirs.Content[i-1]) }); prev >= 0 {
+			at = prev + 1
+		}
+		merged = slices.Insert(merged, at, item)
+	}
+	ours.Content = merged
+	return ours
+}
+
+// Equal reports whether two nodes hold the same data, regardless of style
+// and comments.
+func Equal(a, b *yaml.Node) bool {
+	a, b = content(a), content(b)
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Kind != b.Kind || a.ShortTag() != b.ShortTag() || a.Value != b.Value || len(a.Content) != len(b.Content) {
+		return false
+	}
+	for i := range a.Content {
+		if !Equal(a.Content[i], b.Content[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// content unwraps documents and aliases.
+func content(n *yaml.Node) *yaml.Node {
+	for n != nil {
+		switch {
+		case n.Kind == yaml.DocumentNode && len(n.Content) > 0:
+			n = n.Content[0]
+		case n.Kind == yaml.AliasNode:
+			n = n.Alias
+		default:
+			return n
+		}
+	}
+	return nil
+}
+
+func lookup(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return content(n.Content[i+1])
+		}
+	}
+	return nil
+}
+
+func scalars(n *yaml.Node) bool {
+	if n.Kind != yaml.SequenceNode {
+		return false
+	}
+	for _, item := range n.Content {
+		if content(item).Kind != yaml.ScalarNode {
+			return false
+		}
+	}
+	return true
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// inline writes a value on one line for messages.
+func inline(n *yaml.Node) string {
+	if n == nil {
+		return "nothing"
+	}
+	var flow func(n *yaml.Node) *yaml.Node
+	flow = func(n *yaml.Node) *yaml.Node {
+		c := *n
+		c.HeadComment, c.LineComment, c.FootComment = "", "", ""
+		if c.Kind == yaml.MappingNode || c.Kind == yaml.SequenceNode {
+			c.Style = yaml.FlowStyle
+			c.Content = make([]*yaml.Node, len(n.Content))
+			for i, item := range n.Content {
+				c.Content[i] = flow(item)
+			}
+		}
+		return &c
+	}
+	data, err := yaml.Marshal(flow(n))
+	if err != nil {
+		return n.Value
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,144 @@
+package merge_test
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/localcompose/locom/internal/merge"
+)
+
+func parse(t *testing.T, s string) *yaml.Node {
+	t.Helper()
+	var n yaml.Node
+	if err := yaml.Unmarshal([]byte(s), &n); err != nil {
+		t.Fatal(err)
+	}
+	return &n
+}
+
+func mergeText(t *testing.T, base, ours, theirs string) (string, []merge.Conflict) {
+	t.Helper()
+	var b *yaml.Node
+	if base != "" {
+		b = parse(t, base)
+	}
+	result, conflicts := merge.Merge(b, parse(t, ours), parse(t, theirs))
+	data, err := yaml.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), conflicts
+}
+
+const base = `services:
+    traefik:
+        image: traefik:v2.10
+        command:
+            - --api.dashboard=true
+            - --api.insecure=true
+            - --entrypoints.web.address=:80
+        ports:
+            - 127.0.0.1:80:80
+            - 127.0.0.1:8080:8080
+        labels:
+            traefik.enable: "true"
+`
+
+func TestMerge(t *testing.T) {
+	ours := `services:
+    traefik:
+        # pinned for the plugin
+        image: traefik:v2.10
+        command:
+            - --api.dashboard=true
+            - --api.insecure=true
+            - --entrypoints.web.address=:80
+            - --log.level=DEBUG
+        ports:
+            - 127.0.0.1:80:80
+            - 127.0.0.1:8080:8080
+        environment:
+            TZ: Europe/Paris
+        labels:
+            traefik.enable: "true"
+`
+	theirs := `services:
+    traefik:
+        image: traefik:v3.1
+        command:
+            - --api.dashboard=true
+            - --entrypoints.web.address=:80
+            - --entrypoints.websecure.address=:443
+        ports:
+            - 127.0.0.1:80:80
+            - 127.0.0.1:443:443
+        labels:
+            traefik.enable: "true"
+            traefik.http.routers.traefik.rule: Host(` + "`proxy.locom.self`" + `)
+        restart: unless-stopped
+`
+	want := `services:
+    traefik:
+        # pinned for the plugin
+        image: traefik:v3.1
+        command:
+            - --api.dashboard=true
+            - --entrypoints.web.address=:80
+            - --entrypoints.websecure.address=:443
+            - --log.level=DEBUG
+        ports:
+            - 127.0.0.1:80:80
+            - 127.0.0.1:443:443
+        environment:
+            TZ: Europe/Paris
+        labels:
+            traefik.enable: "true"
+            traefik.http.routers.traefik.rule: Host(` + "`proxy.locom.self`" + `)
+        restart: unless-stopped
+`
+	got, conflicts := mergeText(t, base, ours, theirs)
+	if len(conflicts) > 0 {
+		t.Fatalf("unexpected conflicts: %v", conflicts)
+	}
+	if got != want {
+		t.Errorf("unexpected merge:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMerge_Conflicts(t *testing.T) {
+	ours := strings.Replace(base, "traefik:v2.10", "traefik:v2.11", 1)
+	ours = strings.Replace(ours, "        labels:\n            traefik.enable: \"true\"\n", "", 1)
+	theirs := strings.Replace(base, "traefik:v2.10", "traefik:v3.1", 1)
+	theirs = strings.Replace(theirs, `traefik.enable: "true"`, `traefik.enable: "false"`, 1)
+
+	got, conflicts := mergeText(t, base, ours, theirs)
+	var paths []string
+	for _, c := range conflicts {
+		paths = append(paths, c.String())
+	}
+	want := []string{
+		"services.traefik.image: changed to traefik:v2.11, while the template changes traefik:v2.10 to traefik:v3.1",
+		`services.traefik.labels: changed to nothing, while the template changes {traefik.enable: "true"} to {traefik.enable: "false"}`,
+	}
+	if strings.Join(paths, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected conflicts:\n%s", strings.Join(paths, "\n"))
+	}
+	if got != ours {
+		t.Errorf("expected the user's values to be kept, got:\n%s", got)
+	}
+}
+
+func TestMerge_NoBase(t *testing.T) {
+	ours := "image: traefik:v2.10\nrestart: always\n"
+	theirs := "image: traefik:v2.10\nrestart: unless-stopped\ncontainer_name: traefik\n"
+
+	got, conflicts := mergeText(t, "", ours, theirs)
+	if len(conflicts) != 1 || conflicts[0].Path != "restart" {
+		t.Errorf("expected a conflict on restart, got %v", conflicts)
+	}
+	if want := "image: traefik:v2.10\nrestart: always\ncontainer_name: traefik\n"; got != want {
+		t.Errorf("unexpected merge:\n%s", got)
+	}
+}
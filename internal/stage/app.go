@@ -0,0 +1,234 @@
+package stage
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/localcompose/locom/internal/compose"
+	"github.com/localcompose/locom/internal/config"
+	"github.com/localcompose/locom/internal/files"
+)
+
+// AppOverrideFile is the compose override locom writes next to an app's
+// compose file to route it through the proxy.
+const AppOverrideFile = "docker-compose.locom.yml"
+
+// GenerateAppRoutes writes the routing overrides of the named apps of the
+// stage at root, or of all apps when no name is given. Apps sharing a folder
+// share its override file, which always covers all of them.
+func GenerateAppRoutes(root string, profiles []string, names ...string) error {
+	cfg, err := config.Load(ConfigPath(root), profiles...)
+	if err != nil {
+		return fmt.Errorf("loading configuration: %w", err)
+	}
+	if len(names) == 0 {
+		names = sortedApps(cfg)
+	}
+	if len(names) == 0 {
+		fmt.Println("⚠️ No apps configured in locom.yml")
+		return nil
+	}
+
+	var dirs []string
+	for _, name := range names {
+		app, ok := cfg.Apps[name]
+		if !ok {
+			return fmt.Errorf("unknown app %q", name)
+		}
+		if !slices.Contains(dirs, app.Dir) {
+			dirs = append(dirs, app.Dir)
+		}
+	}
+	for _, dir := range dirs {
+		if err := writeAppRoutes(root, cfg, dir); err != nil {
+			return err
+		}
+	}
+	return writeProxyFiles(files.Disk{}, cfg, ProxyDir(root))
+}
+
+// writeAppRoutes writes the override of the apps in dir. When the folder has
+// a compose file, routed services give up their host ports, which the proxy
+// now serves, and other services those clashing with the proxy's own.
+func writeAppRoutes(root string, cfg *config.Config, dir string) error {
+	var names []string
+	for _, name := range sortedApps(cfg) {
+		if cfg.Apps[name].Dir == dir {
+			names = append(names, name)
+		}
+	}
+
+	path := filepath.Join(root, dir)
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return fmt.Errorf("app %s: folder %s not found (set apps.%s.dir)", names[0], path, names[0])
+	}
+
+	engine, err := compose.EngineFor(cfg)
+	if err != nil {
+		return err
+	}
+	override := compose.ComposeFile{Networks: map[string]compose.Network{}, Services: map[string]compose.Service{}}
+	routed := map[string]string{}
+	for _, name := range names {
+		o, err := engine.AppCompose(cfg, name)
+		if err != nil {
+			return fmt.Errorf("generating routing of app %s: %w", name, err)
+		}
+		service := cfg.Apps[name].Service
+		if other, ok := routed[service]; ok {
+			return fmt.Errorf("apps %s and %s both route service %s of %s", other, name, service, path)
+		}
+		routed[service] = name
+		maps.Copy(override.Networks, o.Networks)
+		maps.Copy(override.Services, o.Services)
+	}
+
+	baseName := "docker-compose.yml"
+	if base, err := compose.FindFile(path); err == nil {
+		baseName = filepath.Base(base)
+		project, err := compose.Load(base)
+		if err != nil {
+			return err
+		}
+		proxy, err := engine.ProxyCompose(cfg)
+		if err != nil {
+			return err
+		}
+		if err := adaptOverride(cfg, proxy, &override, project.Services, routed); err != nil {
+			return err
+		}
+		for service := range routed {
+			if _, ok := project.Services[service]; !ok {
+				fmt.Printf("⚠️ Service %s of app %s is not defined in %s\n", service, routed[service], base)
+			}
+		}
+	}
+
+	data, err := yaml.Marshal(override)
+	if err != nil {
+		return fmt.Errorf("serializing yaml: %w", err)
+	}
+	header := fmt.Sprintf("# Generated by locom from .locom/locom.yml, do not edit.\n# docker compose -f %s -f %s up -d\n", baseName, AppOverrideFile)
+	overridePath := filepath.Join(path, AppOverrideFile)
+	if err := os.WriteFile(overridePath, append([]byte(header), data...), 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", overridePath, err)
+	}
+	for _, name := range names {
+		app := cfg.Apps[name]
+		address := cfg.Hostname(app.Host) + app.Path
+		if !app.HTTP() {
+			address = fmt.Sprintf("%s %s:%d", app.Protocol, address, app.EntryPoint)
+		}
+		fmt.Printf("✅ Routed %s to %s via %s\n", address, name, overridePath)
+	}
+	return nil
+}
+
+// adaptOverride fits the override to the services of the app's compose file.
+func adaptOverride(cfg *config.Config, proxy compose.ComposeFile, override *compose.ComposeFile, services map[string]compose.Service, routed map[string]string) error {
+	for name, s := range services {
+		svc, isRouted := override.Services[name]
+		if isRouted {
+			if s.NetworkMode != "" {
+				return fmt.Errorf("service %s uses network_mode %q and cannot join the stage network", name, s.NetworkMode)
+			}
+			if len(s.Networks) == 0 {
+				// joining the stage network would drop the service from the project's default one
+				svc.Networks = append(compose.Networks("default"), svc.Networks...)
+			}
+			if len(s.Ports) > 0 {
+				svc.PortsMerge = compose.ResetTag
+			}
+			override.Services[name] = svc
+			continue
+		}
+
+		var kept []compose.Port
+		for _, p := range s.Ports {
+			if !clashesWithProxy(cfg, proxy, p) {
+				kept = append(kept, p)
+			}
+		}
+		if len(kept) < len(s.Ports) {
+			svc.Ports = kept
+			svc.PortsMerge = compose.OverrideTag
+			if len(kept) == 0 {
+				svc.PortsMerge = compose.ResetTag
+			}
+			override.Services[name] = svc
+		}
+	}
+	return nil
+}
+
+// clashesWithProxy reports whether a port mapping binds a host port the proxy publishes.
+func clashesWithProxy(cfg *config.Config, proxy compose.ComposeFile, p compose.Port) bool {
+	address := cfg.Stage.Network.Bind.Address
+	for _, svc := range proxy.Services {
+		for _, published := range svc.Ports {
+			port, err := strconv.Atoi(published.Published)
+			if err == nil && p.Binds(address, port) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sortedApps(cfg *config.Config) []string {
+	names := slices.Collect(maps.Keys(cfg.Apps))
+	slices.Sort(names)
+	return names
+}
+
+// AddApp registers an app in the locom.yml of the stage at root and scaffolds
+// its folder: a starter docker-compose.yml, unless the folder already has a
+// compose file under any of the names docker compose looks for, and the
+// routing override.
+func AddApp(root string, profiles []string, name string, app config.App) error {
+	if err := config.AddApp(ConfigPath(root), name, app); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Added app %s to %s\n", name, ConfigPath(root))
+
+	cfg, err := config.Load(ConfigPath(root), profiles...)
+	if err != nil {
+		return fmt.Errorf("loading configuration: %w", err)
+	}
+	dir := filepath.Join(root, cfg.Apps[name].Dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating app folder: %w", err)
+	}
+
+	composePath := filepath.Join(dir, "docker-compose.yml")
+	if existing, err := compose.FindFile(dir); err == nil {
+		fmt.Printf("Skipped writing %s (%s already exists)\n", composePath, filepath.Base(existing))
+	} else {
+		starter, err := compose.GetStarterAppCompose(cfg, name)
+		if err != nil {
+			return err
+		}
+		data, err := yaml.Marshal(starter)
+		if err != nil {
+			return fmt.Errorf("serializing yaml: %w", err)
+		}
+		if err := os.WriteFile(composePath, data, 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", composePath, err)
+		}
+		fmt.Printf("Created %s running %s\n", composePath, starter.Services[cfg.Apps[name].Service].Image)
+	}
+
+	if err := writeAppRoutes(root, cfg, cfg.Apps[name].Dir); err != nil {
+		return err
+	}
+	if app := cfg.Apps[name]; !app.HTTP() {
+		fmt.Printf("⚠️ Run locom proxy to open %s port %d on the proxy\n", app.Protocol, app.EntryPoint)
+	}
+	return writeProxyFiles(files.Disk{}, cfg, ProxyDir(root))
+}
@@ -0,0 +1,306 @@
+package stage_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/localcompose/locom/internal/config"
+	"github.com/localcompose/locom/internal/stage"
+)
+
+func writeStage(t *testing.T, config string) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".locom"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(stage.ConfigPath(root), []byte(config), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return root
+}
+
+func TestGenerateAppRoutes(t *testing.T) {
+	root := writeStage(t, `
+stage:
+  network:
+    name: testnet
+apps:
+  shop:
+    dir: apps/shop
+    service: web
+    port: 3000
+`)
+	appDir := filepath.Join(root, "apps", "shop")
+	if err := os.MkdirAll(appDir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	if err := stage.GenerateAppRoutes(root, nil); err != nil {
+		t.Fatalf("GenerateAppRoutes failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(appDir, stage.AppOverrideFile))
+	if err != nil {
+		t.Fatalf("missing override: %v", err)
+	}
+	for _, want := range []string{"web:", "testnet", "Host(`shop.locom.self`)", "loadbalancer.server.port: \"3000\""} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %q in override:\n%s", want, data)
+		}
+	}
+
+	if err := stage.GenerateAppRoutes(root, nil, "blog"); err == nil || !strings.Contains(err.Error(), `unknown app "blog"`) {
+		t.Errorf("expected unknown app error, got %v", err)
+	}
+}
+
+func TestGenerateAppRoutes_Caddy(t *testing.T) {
+	root := writeStage(t, `
+stage:
+  network:
+    name: testnet
+    proxy:
+      type:
+        engine: caddy
+apps:
+  shop:
+    dir: apps/shop
+    service: web
+    port: 3000
+`)
+	appDir := filepath.Join(root, "apps", "shop")
+	if err := os.MkdirAll(appDir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	if err := stage.GenerateAppRoutes(root, nil); err != nil {
+		t.Fatalf("GenerateAppRoutes failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(appDir, stage.AppOverrideFile))
+	if err != nil {
+		t.Fatalf("missing override: %v", err)
+	}
+	for _, want := range []string{"web:", "testnet:", "aliases:", "- shop"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %q in override:\n%s", want, data)
+		}
+	}
+	if strings.Contains(string(data), "traefik") {
+		t.Errorf("expected no Traefik labels in override:\n%s", data)
+	}
+
+	caddyfile, err := os.ReadFile(filepath.Join(stage.ProxyDir(root), "Caddyfile"))
+	if err != nil {
+		t.Fatalf("missing Caddyfile: %v", err)
+	}
+	for _, want := range []string{"https://shop.locom.self {", "reverse_proxy shop:3000"} {
+		if !strings.Contains(string(caddyfile), want) {
+			t.Errorf("expected %q in Caddyfile:\n%s", want, caddyfile)
+		}
+	}
+}
+
+func TestGenerateAppRoutes_MissingDir(t *testing.T) {
+	root := writeStage(t, `
+stage:
+  network:
+    name: testnet
+apps:
+  shop:
+    port: 3000
+`)
+	err := stage.GenerateAppRoutes(root, nil)
+	if err == nil || !strings.Contains(err.Error(), "set apps.shop.dir") {
+		t.Fatalf("expected missing folder error, got %v", err)
+	}
+}
+
+func TestAddApp(t *testing.T) {
+	root := writeStage(t, `
+stage:
+  network:
+    name: testnet
+apps:
+`)
+	if err := stage.AddApp(root, nil, "shop", config.App{Port: 3000}); err != nil {
+		t.Fatalf("AddApp failed: %v", err)
+	}
+
+	starter, err := os.ReadFile(filepath.Join(root, "shop", "docker-compose.yml"))
+	if err != nil {
+		t.Fatalf("missing starter compose file: %v", err)
+	}
+	for _, want := range []string{"shop:", "traefik/whoami", "\"3000\"", "testnet:", "external: true"} {
+		if !strings.Contains(string(starter), want) {
+			t.Errorf("expected %q in starter compose file:\n%s", want, starter)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "shop", stage.AppOverrideFile)); err != nil {
+		t.Errorf("missing routing override: %v", err)
+	}
+
+	// an existing compose file is kept
+	if err := os.MkdirAll(filepath.Join(root, "blog"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	own := []byte("services: {}\n")
+	if err := os.WriteFile(filepath.Join(root, "blog", "docker-compose.yml"), own, 0644); err != nil {
+		t.Fatalf("write compose: %v", err)
+	}
+	if err := stage.AddApp(root, nil, "blog", config.App{Port: 80}); err != nil {
+		t.Fatalf("AddApp failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "blog", "docker-compose.yml")); string(data) != string(own) {
+		t.Errorf("expected the existing compose file to be kept, got:\n%s", data)
+	}
+
+	// so is one under another name docker compose looks for
+	if err := os.MkdirAll(filepath.Join(root, "wiki"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "wiki", "compose.yaml"), own, 0644); err != nil {
+		t.Fatalf("write compose: %v", err)
+	}
+	if err := stage.AddApp(root, nil, "wiki", config.App{Port: 80}); err != nil {
+		t.Fatalf("AddApp failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "wiki", "docker-compose.yml")); !os.IsNotExist(err) {
+		t.Errorf("expected no starter next to compose.yaml, got err=%v", err)
+	}
+	override, err := os.ReadFile(filepath.Join(root, "wiki", stage.AppOverrideFile))
+	if err != nil {
+		t.Fatalf("missing routing override: %v", err)
+	}
+	if !strings.Contains(string(override), "docker compose -f compose.yaml -f "+stage.AppOverrideFile) {
+		t.Errorf("expected the override to extend compose.yaml, got:\n%s", override)
+	}
+}
+
+func TestImportApps(t *testing.T) {
+	root := writeStage(t, `
+stage:
+  network:
+    name: testnet
+apps:
+`)
+	dir := filepath.Join(root, "Shop App")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	project := `services:
+  web:
+    image: nginx
+    ports:
+      - "8000:80"
+  admin:
+    image: adminer
+    ports:
+      - "80:8080"
+      - "9000:9000"
+  db:
+    image: postgres
+    expose: ["5432"]
+    networks: [back]
+networks:
+  back:
+`
+	if err := os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte(project), 0644); err != nil {
+		t.Fatalf("write compose: %v", err)
+	}
+
+	err := stage.ImportApps(root, nil, dir, stage.ImportOptions{})
+	if err == nil || !strings.Contains(err.Error(), "--service web (port 80)") {
+		t.Fatalf("expected the services to choose from, got %v", err)
+	}
+
+	if err := stage.ImportApps(root, nil, dir, stage.ImportOptions{Services: []string{"web"}}); err != nil {
+		t.Fatalf("ImportApps failed: %v", err)
+	}
+
+	cfg, err := config.LoadConfig(stage.ConfigPath(root))
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	app, ok := cfg.Apps["shop-app"]
+	if !ok {
+		t.Fatalf("expected app named after the folder, got %v", cfg.Apps)
+	}
+	if app.Dir != "Shop App" || app.Service != "web" || app.Port != 80 {
+		t.Errorf("unexpected app: %+v", app)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, stage.AppOverrideFile))
+	if err != nil {
+		t.Fatalf("missing override: %v", err)
+	}
+	override := string(data)
+	for _, want := range []string{
+		"-f docker-compose.yml -f docker-compose.locom.yml",
+		"ports: !reset []",
+		"- default\n            - testnet",
+		"ports: !override\n            - 9000:9000",
+	} {
+		if !strings.Contains(override, want) {
+			t.Errorf("expected %q in override:\n%s", want, override)
+		}
+	}
+	if strings.Contains(override, "db:") {
+		t.Errorf("expected db to be left alone:\n%s", override)
+	}
+}
+
+func TestImportApps_AllOrNothing(t *testing.T) {
+	root := writeStage(t, `
+stage:
+  network:
+    name: testnet
+apps:
+  db:
+    port: 5432
+`)
+	dir := filepath.Join(root, "shop")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	project := `services:
+  admin:
+    image: adminer
+    expose: ["8080"]
+  db:
+    image: postgres
+    expose: ["5432"]
+  web:
+    image: nginx
+    expose: ["80"]
+`
+	if err := os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte(project), 0644); err != nil {
+		t.Fatalf("write compose: %v", err)
+	}
+	before, err := os.ReadFile(stage.ConfigPath(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = stage.ImportApps(root, nil, dir, stage.ImportOptions{Services: []string{"admin", "db", "web"}})
+	if err == nil || !strings.Contains(err.Error(), `app "db" already exists`) {
+		t.Fatalf("expected the clash of db, got %v", err)
+	}
+	after, err := os.ReadFile(stage.ConfigPath(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("expected locom.yml unchanged, got:\n%s", after)
+	}
+
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "docker-compose.yml"), []byte(project), 0644); err != nil {
+		t.Fatalf("write compose: %v", err)
+	}
+	err = stage.ImportApps(root, nil, outside, stage.ImportOptions{Services: []string{"web"}})
+	if err == nil || !strings.Contains(err.Error(), "outside the stage root") {
+		t.Fatalf("expected a project outside the stage to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package stage
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/localcompose/locom/internal/compose"
+	"github.com/localcompose/locom/internal/config"
+)
+
+// ImportOptions selects what ImportApps exposes.
+type ImportOptions struct {
+	// Services to expose; empty means the only service publishing or exposing a port.
+	Services []string
+	// Name of the app when a single service is exposed; defaults to the folder name.
+	Name string
+	// Port of the service when a single service is exposed; defaults to the
+	// container port it publishes or exposes.
+	Port int
+}
+
+// candidate is a service of an imported compose file that can be exposed.
+type candidate struct {
+	Service string
+	Port    int
+}
+
+var nonLabelRe = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// ImportApps registers services of an existing compose project, given as
+// its folder or compose file, as apps of the stage at root and writes their
+// routing override next to the compose file.
+func ImportApps(root string, profiles []string, path string, opts ImportOptions) error {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	var file string
+	if info, err := os.Stat(dir); err != nil {
+		return err
+	} else if info.IsDir() {
+		if file, err = compose.FindFile(dir); err != nil {
+			return err
+		}
+	} else {
+		if !slices.Contains(compose.FileNames, filepath.Base(dir)) {
+			return fmt.Errorf("%s: compose file must be named one of %s, so that it can be found next to its override", path, strings.Join(compose.FileNames, ", "))
+		}
+		file, dir = dir, filepath.Dir(dir)
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return err
+	}
+	if !filepath.IsLocal(rel) {
+		// the override is written next to the compose file, as apps.<name>.dir
+		return fmt.Errorf("%s is outside the stage root %s, move the project into the stage first", path, root)
+	}
+
+	project, err := compose.Load(file)
+	if err != nil {
+		return err
+	}
+	candidates := exposable(project.Services)
+	selected, err := selectServices(file, project.Services, candidates, opts)
+	if err != nil {
+		return err
+	}
+
+	apps := map[string]config.App{}
+	var names []string
+	for _, c := range selected {
+		name := c.Service
+		if len(selected) == 1 {
+			name = opts.Name
+			if name == "" {
+				name = strings.Trim(nonLabelRe.ReplaceAllString(strings.ToLower(filepath.Base(dir)), "-"), "-")
+			}
+		}
+		app := config.App{Port: c.Port}
+		if rel != name {
+			app.Dir = filepath.ToSlash(rel)
+		}
+		if c.Service != name {
+			app.Service = c.Service
+		}
+		apps[name] = app
+		names = append(names, name)
+	}
+	// all apps or none, so that a clash leaves locom.yml as it was
+	if err := config.AddApps(ConfigPath(root), apps); err != nil {
+		return err
+	}
+	for _, name := range names {
+		app := apps[name]
+		fmt.Printf("✅ Added app %s for service %s on port %d\n", name, cmp.Or(app.Service, name), app.Port)
+	}
+	return GenerateAppRoutes(root, profiles, names...)
+}
+
+// exposable proposes the services that can be exposed: those publishing or
+// exposing a container port, which becomes the port the proxy routes to.
+func exposable(services map[string]compose.Service) []candidate {
+	var candidates []candidate
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		s := services[name]
+		port := 0
+		for _, p := range s.Ports {
+			if p.Protocol == "" || p.Protocol == "tcp" {
+				port = p.Target
+				break
+			}
+		}
+		for _, e := range s.Expose {
+			if port != 0 {
+				break
+			}
+			// 5432, 5432/tcp or a range 8000-8010
+			spec, _, _ := strings.Cut(e, "/")
+			first, _, _ := strings.Cut(spec, "-")
+			port, _ = strconv.Atoi(first)
+		}
+		if port != 0 {
+			candidates = append(candidates, candidate{Service: name, Port: port})
+		}
+	}
+	return candidates
+}
+
+func selectServices(file string, services map[string]compose.Service, candidates []candidate, opts ImportOptions) ([]candidate, error) {
+	if len(opts.Services) > 1 && (opts.Name != "" || opts.Port != 0) {
+		return nil, fmt.Errorf("--name and --port apply to a single service")
+	}
+
+	if len(opts.Services) == 0 {
+		switch len(candidates) {
+		case 0:
+			if opts.Port == 0 || len(services) != 1 {
+				return nil, fmt.Errorf("no service of %s publishes or exposes a port, pick one with --service and --port", file)
+			}
+			only := slices.Collect(maps.Keys(services))[0]
+			return []candidate{{Service: only, Port: opts.Port}}, nil
+		case 1:
+			c := candidates[0]
+			if opts.Port != 0 {
+				c.Port = opts.Port
+			}
+			return []candidate{c}, nil
+		default:
+			var lines []string
+			for _, c := range candidates {
+				lines = append(lines, fmt.Sprintf("  --service %s (port %d)", c.Service, c.Port))
+			}
+			return nil, fmt.Errorf("several services of %s could be exposed, pick them with:\n%s", file, strings.Join(lines, "\n"))
+		}
+	}
+
+	var selected []candidate
+	for _, name := range opts.Services {
+		if _, ok := services[name]; !ok {
+			return nil, fmt.Errorf("%s has no service %q", file, name)
+		}
+		c := candidate{Service: name, Port: opts.Port}
+		if i := slices.IndexFunc(candidates, func(c candidate) bool { return c.Service == name }); i >= 0 && c.Port == 0 {
+			c.Port = candidates[i].Port
+		}
+		if c.Port == 0 {
+			return nil, fmt.Errorf("service %s publishes or exposes no port, set it with --port", name)
+		}
+		selected = append(selected, c)
+	}
+	return selected, nil
+}
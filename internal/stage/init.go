@@ -23,7 +23,7 @@ func Init(targetDir string) error {
 		return fmt.Errorf("directory %q is not empty; please run 'locom init' in an empty folder", targetDir)
 	}
 
-	locomDir := filepath.Join(targetDir, ".locom")
+	locomDir := filepath.Join(targetDir, LocomDir)
 	if _, err := os.Stat(locomDir); err == nil {
 		return fmt.Errorf("stage already initialized: %q already exists", locomDir)
 	} else if !os.IsNotExist(err) {
@@ -34,7 +34,7 @@ func Init(targetDir string) error {
 		return fmt.Errorf("creating .locom directory: %w", err)
 	}
 
-	ymlPath := filepath.Join(locomDir, "locom.yml")
+	ymlPath := filepath.Join(locomDir, ConfigFile)
 	f, err := os.OpenFile(ymlPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return fmt.Errorf("creating locom.yml: %w", err)
@@ -63,7 +63,9 @@ func isDirEmpty(path string) (bool, error) {
 	return true, nil
 }
 
-const defaultConfig = `stage:
+const defaultConfig = `version: 1
+
+stage:
   network:
     name: locom
 
@@ -77,7 +79,7 @@ const defaultConfig = `stage:
       name: traefik
       type: 
         engine: traefik
-        version: 2.10
+        version: "2.10"
 
 apps:
 `
@@ -3,7 +3,11 @@ package stage
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/localcompose/locom/internal/config"
+	"github.com/localcompose/locom/internal/diff"
 )
 
 func TestInit_CreatesStageInEmptyDir(t *testing.T) {
@@ -53,3 +57,36 @@ func TestInit_FailsIfAlreadyInitialized(t *testing.T) {
 		t.Fatal("expected Init to fail if .locom already exists, but it succeeded")
 	}
 }
+
+func TestInit_ConfigKeepsLayoutOnSet(t *testing.T) {
+	tmp := t.TempDir()
+	if err := Init(tmp); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	path := ConfigPath(tmp)
+
+	if err := config.Set(path, "stage.network.bind.address", "127.0.0.2"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(defaultConfig, "address: 127.0.0.1", "address: 127.0.0.2", 1)
+	if string(data) != want {
+		t.Errorf("expected only the address line changed, got:\n%s", diff.Unified("want", "got", []byte(want), data))
+	}
+
+	// a new key lands at the end of its section, before the blank line
+	if err := config.Set(path, "stage.network.proxy.tls", "both"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = strings.Replace(want, "        version: \"2.10\"\n", "        version: \"2.10\"\n      tls: both\n", 1)
+	if string(data) != want {
+		t.Errorf("expected the tls line added, got:\n%s", diff.Unified("want", "got", []byte(want), data))
+	}
+}
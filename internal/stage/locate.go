@@ -0,0 +1,59 @@
+package stage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// LocomDir is the folder marking the root of a stage.
+	LocomDir   = ".locom"
+	ConfigFile = "locom.yml"
+)
+
+// Find returns the stage root: dir itself or the nearest parent containing a .locom folder.
+func Find(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("resolving %q: %w", dir, err)
+	}
+
+	for d := abs; ; {
+		if isStage(d) {
+			return d, nil
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return "", fmt.Errorf("not inside a locom stage: no %s folder found in %s or any parent (run 'locom init' or pass --stage)", LocomDir, abs)
+		}
+		d = parent
+	}
+}
+
+// Open returns the absolute path of root after checking it is a stage.
+func Open(root string) (string, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("resolving %q: %w", root, err)
+	}
+	if !isStage(abs) {
+		return "", fmt.Errorf("%s is not a locom stage: no %s folder found", abs, LocomDir)
+	}
+	return abs, nil
+}
+
+func isStage(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, LocomDir))
+	return err == nil && info.IsDir()
+}
+
+// ConfigPath is the locom.yml of the stage at root.
+func ConfigPath(root string) string {
+	return filepath.Join(root, LocomDir, ConfigFile)
+}
+
+// ProxyDir is the folder holding the proxy's compose project.
+func ProxyDir(root string) string {
+	return filepath.Join(root, "proxy")
+}
@@ -0,0 +1,54 @@
+package stage_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/localcompose/locom/internal/stage"
+)
+
+func TestFind_WalksUpToStageRoot(t *testing.T) {
+	root := t.TempDir()
+	if err := stage.Init(root); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	nested := filepath.Join(root, "proxy", "config")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	for _, dir := range []string{root, nested} {
+		got, err := stage.Find(dir)
+		if err != nil {
+			t.Fatalf("Find(%q) failed: %v", dir, err)
+		}
+		if got != root {
+			t.Errorf("Find(%q) = %q, want %q", dir, got, root)
+		}
+	}
+}
+
+func TestFind_FailsOutsideStage(t *testing.T) {
+	if _, err := stage.Find(t.TempDir()); err == nil {
+		t.Fatal("expected Find to fail outside of a stage, but it succeeded")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	root := t.TempDir()
+	if _, err := stage.Open(root); err == nil {
+		t.Fatal("expected Open to fail on a folder without .locom")
+	}
+
+	if err := stage.Init(root); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	got, err := stage.Open(root)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if got != root {
+		t.Errorf("Open(%q) = %q", root, got)
+	}
+}
@@ -2,58 +2,222 @@ package stage
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 
 	"github.com/localcompose/locom/internal/compose"
 	"github.com/localcompose/locom/internal/config"
+	"github.com/localcompose/locom/internal/files"
+	"github.com/localcompose/locom/internal/htpasswd"
+	"github.com/localcompose/locom/internal/merge"
 )
 
-func GenerateProxyComposeFiles(configPath, targetDir string) error {
-	cfg, err := config.LoadConfig(configPath)
+// DashboardUsersFile is the htpasswd file of the dashboard user in the
+// locom folder; the proxy mounts it for its basic-auth middleware.
+const DashboardUsersFile = "dashboard.htpasswd"
+
+// ProxyOptions controls how GenerateProxyComposeFiles updates a proxy
+// compose file that already exists.
+type ProxyOptions struct {
+	// Force replaces the file with the template, dropping local changes.
+	Force bool
+}
+
+// GenerateProxyComposeFiles renders the proxy compose file into the locom
+// folder, as .locom/proxy/docker-compose.yml, and into targetDir. A file in
+// targetDir that was edited since it was generated gets the template changes
+// merged in, using the copy in the locom folder as their common base; values
+// both sides changed are reported as conflicts and nothing is written.
+func GenerateProxyComposeFiles(w files.Writer, configPath string, profiles []string, targetDir string, opts ProxyOptions) error {
+	cfg, err := config.Load(configPath, profiles...)
 	if err != nil {
 		return fmt.Errorf("loading configuration: %w", err)
 	}
 
-	networkName := cfg.Stage.Network.Name
-	if networkName == "" {
-		return fmt.Errorf("network name not found in configuration")
-	}
-
 	// Generate the compose content
-	composeData := compose.GetTraefikCompose(networkName)
+	engine, err := compose.EngineFor(cfg)
+	if err != nil {
+		return err
+	}
+	composeData, err := engine.ProxyCompose(cfg)
+	if err != nil {
+		return fmt.Errorf("generating proxy compose file: %w", err)
+	}
 	ymlData, err := yaml.Marshal(composeData)
 	if err != nil {
 		return fmt.Errorf("serializing yaml: %w", err)
 	}
 
-	// 1. Write the template source under .locom/proxy/
-	sourcePath := filepath.Join(filepath.Dir(configPath), "proxy")
-	if err := os.MkdirAll(sourcePath, 0755); err != nil {
-		return fmt.Errorf("creating .locom/proxy folder: %w", err)
+	sourceFile := filepath.Join(filepath.Dir(configPath), "proxy", "docker-compose.yml")
+	targetFile := filepath.Join(targetDir, "docker-compose.yml")
+
+	// 1. Work out the new ./proxy/docker-compose.yml
+	current, err := os.ReadFile(targetFile)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("reading %s: %w", targetFile, err)
+	}
+	result, action := ymlData, "Created %s from template\n"
+	var conflicts []merge.Conflict
+	switch {
+	case !exists:
+	case opts.Force:
+		action = "✅ Replaced %s with the template\n"
+	default:
+		base, err := os.ReadFile(sourceFile)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("reading %s: %w", sourceFile, err)
+		}
+		if result, conflicts, err = mergeProxyFile(base, current, ymlData); err != nil {
+			return fmt.Errorf("merging %s: %w", targetFile, err)
+		}
+		action = "✅ Updated %s from template\n"
+		if string(current) != string(base) {
+			action = "✅ Merged template changes into %s, keeping your edits\n"
+		}
+	}
+	if exists && string(result) == string(current) {
+		action = "✅ %s is up to date\n"
+	}
+
+	if len(conflicts) > 0 {
+		lines := make([]string, len(conflicts))
+		for i, c := range conflicts {
+			lines[i] = "  " + c.String()
+		}
+		if !w.DryRun() {
+			return fmt.Errorf("not updating %s, your edits conflict with the template:\n%s\nedit the file to resolve them, or rerun with --force to replace it with the template (--diff shows the changes)",
+				targetFile, strings.Join(lines, "\n"))
+		}
+		// the preview shows the merge, with the user's values kept
+		fmt.Printf("⚠️ Your edits of %s conflict with the template:\n%s\n", targetFile, strings.Join(lines, "\n"))
 	}
-	sourceFile := filepath.Join(sourcePath, "docker-compose.yml")
-	if err := os.WriteFile(sourceFile, ymlData, 0644); err != nil {
-		return fmt.Errorf("writing source docker-compose.yml: %w", err)
+
+	// 2. Set up the dashboard credentials, only now that the run goes ahead
+	if user := cfg.Stage.Network.Proxy.Dashboard.User; user != "" {
+		usersFile := filepath.Join(filepath.Dir(configPath), DashboardUsersFile)
+		if current, err := htpasswd.User(usersFile); err != nil || current != user {
+			if err := writeDashboardUser(w, usersFile, user, ""); err != nil {
+				return err
+			}
+		}
 	}
 
-	// 2. Copy it to ./proxy/docker-compose.yml if it doesn't already exist
-	if err := os.MkdirAll(targetDir, 0755); err != nil {
-		return fmt.Errorf("creating proxy target folder: %w", err)
+	// 3. Write ./proxy/docker-compose.yml
+	if err := w.WriteFile(targetFile, result, 0644); err != nil {
+		return fmt.Errorf("writing proxy/docker-compose.yml: %w", err)
+	}
+	if !w.DryRun() {
+		fmt.Printf(action, targetFile)
+	}
+
+	// 4. Write the configuration files the proxy reads
+	if err := writeProxyFiles(w, cfg, targetDir); err != nil {
+		return err
 	}
-	targetFile := filepath.Join(targetDir, "docker-compose.yml")
 
-	if _, err := os.Stat(targetFile); os.IsNotExist(err) {
-		// Only write if file does not exist
-		if err := os.WriteFile(targetFile, ymlData, 0644); err != nil {
-			return fmt.Errorf("writing proxy/docker-compose.yml: %w", err)
+	// 5. Keep the template under .locom/proxy/ as the base of the next merge,
+	// only once the user file has it
+	if len(conflicts) == 0 {
+		if err := w.WriteFile(sourceFile, ymlData, 0644); err != nil {
+			return fmt.Errorf("writing source docker-compose.yml: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// writeProxyFiles writes the configuration files of the proxy engine into
+// targetDir.
+func writeProxyFiles(w files.Writer, cfg *config.Config, targetDir string) error {
+	engine, err := compose.EngineFor(cfg)
+	if err != nil {
+		return err
+	}
+	proxyFiles, err := engine.ProxyFiles(cfg)
+	if err != nil {
+		return fmt.Errorf("generating proxy configuration: %w", err)
+	}
+	for _, name := range slices.Sorted(maps.Keys(proxyFiles)) {
+		path := filepath.Join(targetDir, name)
+		current, err := os.ReadFile(path)
+		changed := err != nil || string(current) != string(proxyFiles[name])
+		if err := w.WriteFile(path, proxyFiles[name], 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", path, err)
+		}
+		if changed && !w.DryRun() {
+			fmt.Printf("✅ Wrote %s, restart the proxy to load it\n", path)
+		}
+	}
+	return nil
+}
+
+// mergeProxyFile merges the template changes from base to template into the
+// user's file. Without a base, e.g. for files generated by older versions,
+// every value the user file has differently is a conflict.
+func mergeProxyFile(base, current, template []byte) ([]byte, []merge.Conflict, error) {
+	var ours, theirs yaml.Node
+	if err := yaml.Unmarshal(current, &ours); err != nil {
+		return nil, nil, err
+	}
+	if len(ours.Content) == 0 {
+		return template, nil, nil
+	}
+	if err := yaml.Unmarshal(template, &theirs); err != nil {
+		return nil, nil, err
+	}
+	var baseNode *yaml.Node
+	if len(base) > 0 {
+		baseNode = &yaml.Node{}
+		if err := yaml.Unmarshal(base, baseNode); err != nil {
+			return nil, nil, fmt.Errorf("reading the previous template: %w", err)
 		}
-		fmt.Printf("Created %s from template\n", targetFile)
-	} else {
-		fmt.Printf("Skipped writing %s (already exists)\n", targetFile)
 	}
 
+	result, conflicts := merge.Merge(baseNode, &ours, &theirs)
+	data, err := yaml.Marshal(result)
+	return data, conflicts, err
+}
+
+// SetDashboardPassword sets the password of the dashboard user of the stage
+// at root; an empty password is replaced by a generated one.
+func SetDashboardPassword(root string, profiles []string, password string) error {
+	cfg, err := config.Load(ConfigPath(root), profiles...)
+	if err != nil {
+		return fmt.Errorf("loading configuration: %w", err)
+	}
+	user := cfg.Stage.Network.Proxy.Dashboard.User
+	if user == "" {
+		return fmt.Errorf("no dashboard user configured (set stage.network.proxy.dashboard.user first)")
+	}
+	return writeDashboardUser(files.Disk{}, filepath.Join(root, LocomDir, DashboardUsersFile), user, password)
+}
+
+func writeDashboardUser(w files.Writer, path, user, password string) error {
+	generated := password == ""
+	if generated {
+		var err error
+		if password, err = htpasswd.Password(20); err != nil {
+			return err
+		}
+	}
+	if err := htpasswd.Write(w, path, user, password); err != nil {
+		return fmt.Errorf("writing dashboard credentials: %w", err)
+	}
+	if w.DryRun() {
+		// no password is set, so none is shown
+		return nil
+	}
+	if generated {
+		fmt.Printf("🔑 Dashboard user %q has the password %s\n", user, password)
+	} else {
+		fmt.Printf("🔑 Dashboard password of %q updated\n", user)
+	}
+	fmt.Printf("✅ Stored the password hash in %s\n", path)
 	return nil
 }
@@ -1,10 +1,13 @@
 package stage_test
 
 import (
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/localcompose/locom/internal/files"
 	"github.com/localcompose/locom/internal/stage"
 )
 
@@ -30,7 +33,7 @@ stage:
 	}
 
 	// Run the function
-	err := stage.GenerateProxyComposeFiles(configPath, targetDir)
+	err := stage.GenerateProxyComposeFiles(files.Disk{}, configPath, nil, targetDir, stage.ProxyOptions{})
 	if err != nil {
 		t.Fatalf("GenerateProxyComposeFiles failed: %v", err)
 	}
@@ -51,6 +54,66 @@ stage:
 	}
 }
 
+func TestGenerateProxyComposeFiles_DashboardUser(t *testing.T) {
+	root := t.TempDir()
+	configDir := filepath.Join(root, ".locom")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	configContent := `
+stage:
+  network:
+    name: testnet
+    proxy:
+      dashboard:
+        insecure: false
+        user: admin
+`
+	configPath := filepath.Join(configDir, "locom.yml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	if err := stage.GenerateProxyComposeFiles(files.Disk{}, configPath, nil, filepath.Join(root, "proxy"), stage.ProxyOptions{}); err != nil {
+		t.Fatalf("GenerateProxyComposeFiles failed: %v", err)
+	}
+
+	usersFile := filepath.Join(configDir, stage.DashboardUsersFile)
+	first, err := os.ReadFile(usersFile)
+	if err != nil {
+		t.Fatalf("missing htpasswd file: %v", err)
+	}
+	if !containsAll(string(first), "admin:$apr1$") {
+		t.Errorf("unexpected htpasswd content: %s", first)
+	}
+	if info, err := os.Stat(usersFile); err == nil && info.Mode().Perm() != 0o600 {
+		t.Errorf("expected htpasswd mode 0600, got %v", info.Mode().Perm())
+	}
+
+	compose, err := os.ReadFile(filepath.Join(configDir, "proxy", "docker-compose.yml"))
+	if err != nil {
+		t.Fatalf("read compose: %v", err)
+	}
+	if contains(string(compose), "api.insecure") || !containsAll(string(compose), "basicauth.usersfile", "dashboard.htpasswd:ro") {
+		t.Errorf("unexpected compose content:\n%s", compose)
+	}
+
+	// regenerating keeps the existing password
+	if err := stage.GenerateProxyComposeFiles(files.Disk{}, configPath, nil, filepath.Join(root, "proxy"), stage.ProxyOptions{}); err != nil {
+		t.Fatalf("GenerateProxyComposeFiles failed: %v", err)
+	}
+	if second, _ := os.ReadFile(usersFile); string(second) != string(first) {
+		t.Errorf("expected the htpasswd file to be kept, got %s", second)
+	}
+
+	if err := stage.SetDashboardPassword(root, nil, "s3cret"); err != nil {
+		t.Fatalf("SetDashboardPassword failed: %v", err)
+	}
+	if third, _ := os.ReadFile(usersFile); string(third) == string(first) {
+		t.Error("expected the password to change")
+	}
+}
+
 func containsAll(s string, substrings ...string) bool {
 	for _, sub := range substrings {
 		if !contains(s, sub) {
@@ -63,3 +126,87 @@ func containsAll(s string, substrings ...string) bool {
 func contains(s, sub string) bool {
 	return len(s) >= len(sub) && (s == sub || (len(s) > len(sub) && (s[0:len(sub)] == sub || contains(s[1:], sub))))
 }
+
+func TestGenerateProxyComposeFiles_Merge(t *testing.T) {
+	root := t.TempDir()
+	configDir := filepath.Join(root, ".locom")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	configPath := filepath.Join(configDir, "locom.yml")
+	writeConfig := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+	}
+	generate := func(w files.Writer, opts stage.ProxyOptions) error {
+		return stage.GenerateProxyComposeFiles(w, configPath, nil, filepath.Join(root, "proxy"), opts)
+	}
+	userFile := filepath.Join(root, "proxy", "docker-compose.yml")
+	baseFile := filepath.Join(configDir, "proxy", "docker-compose.yml")
+
+	writeConfig("stage:\n  network:\n    name: testnet\n")
+	if err := generate(files.Disk{}, stage.ProxyOptions{}); err != nil {
+		t.Fatalf("GenerateProxyComposeFiles failed: %v", err)
+	}
+
+	// the user adds a flag and a comment, the stage switches to plain http
+	data, _ := os.ReadFile(userFile)
+	edited := strings.Replace(string(data), "            - --providers.file.watch=true\n",
+		"            - --providers.file.watch=true\n            # chatty\n            - --log.level=DEBUG\n", 1)
+	if err := os.WriteFile(userFile, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeConfig("stage:\n  network:\n    name: testnet\n    proxy:\n      tls: http\n")
+	if err := generate(files.Preview{Out: io.Discard}, stage.ProxyOptions{}); err != nil {
+		t.Fatalf("GenerateProxyComposeFiles preview failed: %v", err)
+	}
+	if data, _ := os.ReadFile(userFile); string(data) != edited {
+		t.Fatal("expected the preview to leave the file alone")
+	}
+	if err := generate(files.Disk{}, stage.ProxyOptions{}); err != nil {
+		t.Fatalf("GenerateProxyComposeFiles failed: %v", err)
+	}
+	merged, _ := os.ReadFile(userFile)
+	if !containsAll(string(merged), "# chatty", "--log.level=DEBUG") || contains(string(merged), "websecure") {
+		t.Errorf("expected the edit kept and https dropped:\n%s", merged)
+	}
+	base, _ := os.ReadFile(baseFile)
+	if contains(string(base), "websecure") {
+		t.Errorf("expected the base to be the new template:\n%s", base)
+	}
+
+	// both change the image: nothing is written until forced
+	conflicting := strings.Replace(string(merged), "image: traefik:v2.10", "image: traefik:v2.11", 1)
+	if err := os.WriteFile(userFile, []byte(conflicting), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a new dashboard user gets no password from a run that does not go ahead
+	writeConfig("stage:\n  network:\n    name: testnet\n    proxy:\n      tls: http\n      type:\n        version: \"3.1\"\n      dashboard:\n        insecure: false\n        user: admin\n")
+	usersFile := filepath.Join(configDir, stage.DashboardUsersFile)
+	err := generate(files.Disk{}, stage.ProxyOptions{})
+	if err == nil || !strings.Contains(err.Error(), "services.traefik.image") {
+		t.Fatalf("expected a conflict on the image, got %v", err)
+	}
+	if data, _ := os.ReadFile(userFile); string(data) != conflicting {
+		t.Error("expected the conflicting file to be left alone")
+	}
+	if data, _ := os.ReadFile(baseFile); string(data) != string(base) {
+		t.Error("expected the base to be kept until the file is updated")
+	}
+	if _, err := os.Stat(usersFile); !os.IsNotExist(err) {
+		t.Errorf("expected no dashboard credentials written on a conflict, got %v", err)
+	}
+
+	if err := generate(files.Disk{}, stage.ProxyOptions{Force: true}); err != nil {
+		t.Fatalf("GenerateProxyComposeFiles --force failed: %v", err)
+	}
+	forced, _ := os.ReadFile(userFile)
+	if !contains(string(forced), "traefik:v3.1") || contains(string(forced), "--log.level") {
+		t.Errorf("expected the template, got:\n%s", forced)
+	}
+	if _, err := os.Stat(usersFile); err != nil {
+		t.Errorf("expected the dashboard credentials written with the file: %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package locom
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/localcompose/locom/internal/cert/selfsigned"
+	"github.com/localcompose/locom/internal/config"
+	"github.com/localcompose/locom/internal/files"
+	"github.com/localcompose/locom/internal/hosts"
+	"github.com/localcompose/locom/internal/stage"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmdAppAdd.Flags().String("dir", "", "folder of the app's compose file, relative to the stage root (default: the app name)")
+	cmdAppAdd.Flags().String("service", "", "compose service receiving the traffic (default: the app name)")
+	cmdAppAdd.Flags().Int("port", 80, "port the service listens on inside its container")
+	cmdAppAdd.Flags().String("host", "", "hostname prefix, the app answers on <host><dns.suffix> (default: the app name)")
+	cmdAppAdd.Flags().StringSlice("alias", nil, "extra hostname prefix (repeatable)")
+	cmdAppAdd.Flags().String("path", "", "only route requests below this path prefix, e.g. to share a hostname with other apps")
+	cmdAppAdd.Flags().Bool("strip", false, "remove --path from requests before passing them to the app")
+	cmdAppAdd.Flags().StringToString("header", nil, "only route requests carrying this header value, as Name=value (repeatable, traefik only)")
+	cmdAppAdd.Flags().Bool("tls", true, "serve the app over https; for a tcp app, accept TLS connections routed by SNI")
+	cmdAppAdd.Flags().String("protocol", "", "http, or tcp and udp routed on --entrypoint (default: http)")
+	cmdAppAdd.Flags().Int("entrypoint", 0, "port the proxy listens on for a tcp or udp app")
+	cmdAppAdd.Flags().Bool("passthrough", false, "pass the TLS connections of a tcp app through instead of terminating them")
+	cmdApp.AddCommand(cmdAppAdd)
+
+	cmdAppImport.Flags().StringSlice("service", nil, "service to expose (repeatable, default: the only service with a port)")
+	cmdAppImport.Flags().String("name", "", "app name when exposing a single service (default: the folder name)")
+	cmdAppImport.Flags().Int("port", 0, "container port when exposing a single service (default: the published or exposed one)")
+	cmdApp.AddCommand(cmdAppImport)
+	cmdApp.AddCommand(cmdAppRoute)
+
+	rootCmd.AddCommand(cmdApp)
+}
+
+var cmdApp = &cobra.Command{
+	Use:   "app",
+	Short: "Manage the apps routed through the proxy",
+	Annotations: map[string]string{
+		"helpdisplayorder": "55",
+	},
+}
+
+var cmdAppRoute = &cobra.Command{
+	Use:   "route [app...]",
+	Short: "Generate the compose overrides routing apps through the proxy",
+	Long: `Write ` + stage.AppOverrideFile + ` into the folder of each app (all apps by default).
+The override joins the app's service to the stage network and adds the proxy
+labels routing its hostnames to apps.<name>.port.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := stageRoot(cmd)
+		if err != nil {
+			return err
+		}
+		profiles, err := stageProfiles(cmd, root)
+		if err != nil {
+			return err
+		}
+		return stage.GenerateAppRoutes(root, profiles, args...)
+	},
+}
+
+var cmdAppAdd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Register a new app and scaffold its folder",
+	Long: `Add an app to the apps section of locom.yml, keeping the file's comments.
+Its folder gets a starter docker-compose.yml attached to the stage network,
+unless it has a compose file already, and the ` + stage.AppOverrideFile + ` routing it through the proxy.
+The hosts file and the self-signed certificate are updated when they were set
+up before and miss the app's hostnames; when that fails, the app stays added
+and a warning names the command to run.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := stageRoot(cmd)
+		if err != nil {
+			return err
+		}
+		var app config.App
+		if app.Dir, err = cmd.Flags().GetString("dir"); err != nil {
+			return fmt.Errorf("failed to read dir flag: %w", err)
+		}
+		if app.Service, err = cmd.Flags().GetString("service"); err != nil {
+			return fmt.Errorf("failed to read service flag: %w", err)
+		}
+		if app.Port, err = cmd.Flags().GetInt("port"); err != nil {
+			return fmt.Errorf("failed to read port flag: %w", err)
+		}
+		if app.Host, err = cmd.Flags().GetString("host"); err != nil {
+			return fmt.Errorf("failed to read host flag: %w", err)
+		}
+		if app.Aliases, err = cmd.Flags().GetStringSlice("alias"); err != nil {
+			return fmt.Errorf("failed to read alias flag: %w", err)
+		}
+		if app.Path, err = cmd.Flags().GetString("path"); err != nil {
+			return fmt.Errorf("failed to read path flag: %w", err)
+		}
+		if app.Strip, err = cmd.Flags().GetBool("strip"); err != nil {
+			return fmt.Errorf("failed to read strip flag: %w", err)
+		}
+		if app.Headers, err = cmd.Flags().GetStringToString("header"); err != nil {
+			return fmt.Errorf("failed to read header flag: %w", err)
+		}
+		if app.Protocol, err = cmd.Flags().GetString("protocol"); err != nil {
+			return fmt.Errorf("failed to read protocol flag: %w", err)
+		}
+		if app.EntryPoint, err = cmd.Flags().GetInt("entrypoint"); err != nil {
+			return fmt.Errorf("failed to read entrypoint flag: %w", err)
+		}
+		if app.Passthrough, err = cmd.Flags().GetBool("passthrough"); err != nil {
+			return fmt.Errorf("failed to read passthrough flag: %w", err)
+		}
+		if cmd.Flags().Changed("tls") {
+			tls, err := cmd.Flags().GetBool("tls")
+			if err != nil {
+				return fmt.Errorf("failed to read tls flag: %w", err)
+			}
+			app.TLS = &tls
+		}
+
+		profiles, err := stageProfiles(cmd, root)
+		if err != nil {
+			return err
+		}
+		if err := stage.AddApp(root, profiles, args[0], app); err != nil {
+			return err
+		}
+		refreshHostnames(root, profiles)
+		return nil
+	},
+}
+
+var cmdAppImport = &cobra.Command{
+	Use:   "import <path>",
+	Short: "Route the services of an existing compose project through the proxy",
+	Long: `Read the compose file at path (a folder or the file itself) and register the
+services to expose as apps in locom.yml. Without --service, the only service
+publishing or exposing a port is picked; when there are several, they are
+listed to choose from. The project must be inside the stage root, and the
+apps are added all at once: when one clashes, none is.
+
+The ` + stage.AppOverrideFile + ` written next to the compose file attaches the
+services to the stage network, drops their host port bindings, which the proxy
+now serves, and drops those of other services that clash with the proxy's ports.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := stageRoot(cmd)
+		if err != nil {
+			return err
+		}
+		var opts stage.ImportOptions
+		if opts.Services, err = cmd.Flags().GetStringSlice("service"); err != nil {
+			return fmt.Errorf("failed to read service flag: %w", err)
+		}
+		if opts.Name, err = cmd.Flags().GetString("name"); err != nil {
+			return fmt.Errorf("failed to read name flag: %w", err)
+		}
+		if opts.Port, err = cmd.Flags().GetInt("port"); err != nil {
+			return fmt.Errorf("failed to read port flag: %w", err)
+		}
+
+		profiles, err := stageProfiles(cmd, root)
+		if err != nil {
+			return err
+		}
+		if err := stage.ImportApps(root, profiles, args[0], opts); err != nil {
+			return err
+		}
+		refreshHostnames(root, profiles)
+		return nil
+	},
+}
+
+// refreshHostnames updates the hosts file and the self-signed certificate of
+// the stage if they were set up before and miss some of its hostnames. The
+// apps are registered by then, so failures, e.g. without the rights to write
+// the hosts file, only warn with the command to run once fixed.
+func refreshHostnames(root string, profiles []string) {
+	if err := refreshHosts(root, profiles); err != nil {
+		fmt.Printf("⚠️ Hosts file not updated: %v\nRun locom hosts to add the new hostnames\n", err)
+	}
+	if err := refreshCert(root, profiles); err != nil {
+		fmt.Printf("⚠️ Certificate not reissued: %v\nRun locom cert selfsigned setup to cover the new hostnames\n", err)
+	}
+}
+
+func refreshHosts(root string, profiles []string) error {
+	outdated, err := hosts.Outdated(root, profiles)
+	if err != nil || !outdated {
+		return err
+	}
+	return hosts.Setup(files.Disk{}, root, profiles, false)
+}
+
+func refreshCert(root string, profiles []string) error {
+	missing, err := selfsigned.Uncovered(root, profiles)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	case len(missing) > 0:
+		if err := selfsigned.Setup(files.Disk{}, root, profiles); err != nil {
+			return err
+		}
+		fmt.Printf("✅ Certificate reissued for %s, restart the proxy to load it\n", strings.Join(missing, ", "))
+	}
+	return nil
+}
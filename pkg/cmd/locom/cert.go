@@ -7,6 +7,7 @@ import (
 
 func init() {
 	cmdCert.AddCommand(cmdSelfSigned)
+	diffFlag(cmdSelfSignedSetup)
 	cmdSelfSigned.AddCommand(cmdSelfSignedSetup)
 	cmdSelfSigned.AddCommand(cmdSelfSignedTrust)
 	cmdSelfSigned.AddCommand(cmdSelfSignedUntrust)
@@ -25,22 +26,42 @@ var cmdCert = &cobra.Command{
 
 var cmdSelfSigned = &cobra.Command{
 	Use:   "selfsigned",
-	Short: "Generate a self-signed certificate for .locom.self",
+	Short: "Generate a self-signed certificate for the stage's DNS suffix",
 }
 
 var cmdSelfSignedSetup = &cobra.Command{
 	Use:   "setup",
-	Short: "Generate a self-signed certificate for .locom.self",
+	Short: "Generate a self-signed certificate for the stage's DNS suffix",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return selfsigned.Setup()
+		root, err := stageRoot(cmd)
+		if err != nil {
+			return err
+		}
+		profiles, err := stageProfiles(cmd, root)
+		if err != nil {
+			return err
+		}
+		w, err := fileWriter(cmd)
+		if err != nil {
+			return err
+		}
+		return selfsigned.Setup(w, root, profiles)
 	},
 }
 
 var cmdSelfSignedTrust = &cobra.Command{
 	Use:   "trust",
-	Short: "trust the self-signed certificate for .locom.self",
+	Short: "trust the self-signed certificate for the stage's DNS suffix",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return selfsigned.TrustSetup()
+		root, err := stageRoot(cmd)
+		if err != nil {
+			return err
+		}
+		profiles, err := stageProfiles(cmd, root)
+		if err != nil {
+			return err
+		}
+		return selfsigned.TrustSetup(root, profiles)
 	},
 }
 
@@ -49,7 +70,11 @@ var cmdSelfSignedUntrust = &cobra.Command{
 	Use:   "untrust",
 	Short: "Remove/unregister the self-signed certificate from all trust stores",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return selfsigned.TrustCleanup()
+		root, err := stageRoot(cmd)
+		if err != nil {
+			return err
+		}
+		return selfsigned.TrustCleanup(root)
 	},
 }
 
@@ -57,6 +82,10 @@ var cmdSelfSignedCleanup = &cobra.Command{
 	Use:   "cleanup",
 	Short: "Remove self-signed cert and its trust config",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return selfsigned.Cleanup()
+		root, err := stageRoot(cmd)
+		if err != nil {
+			return err
+		}
+		return selfsigned.Cleanup(root)
 	},
 }
@@ -0,0 +1,220 @@
+package locom
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/localcompose/locom/internal/config"
+	"github.com/localcompose/locom/internal/stage"
+)
+
+func init() {
+	cmdConfig.AddCommand(cmdConfigValidate)
+	cmdConfig.AddCommand(cmdConfigSchema)
+	cmdConfig.AddCommand(cmdConfigShow)
+	cmdConfig.AddCommand(cmdConfigMigrate)
+	cmdConfig.AddCommand(cmdConfigGet)
+	cmdConfig.AddCommand(cmdConfigSet)
+
+	cmdConfigShow.Flags().Bool("resolved", false, "Show the effective configuration after interpolation and defaults")
+
+	cmdConfigSchema.Flags().StringP("output", "o", "", "Write the schema to this file instead of stdout")
+
+	rootCmd.AddCommand(cmdConfig)
+}
+
+var cmdConfig = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect and validate the stage configuration",
+	Annotations: map[string]string{
+		"helpdisplayorder": "25",
+	},
+}
+
+var cmdConfigValidate = &cobra.Command{
+	Use:   "validate",
+	Short: "Check .locom/locom.yml and report every problem found",
+	Long: `Decodes and validates .locom/locom.yml in one pass and prints every problem
+as file:line:column: message. Exits with a non-zero status if any is found,
+so it can be used in CI and pre-commit hooks.`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := stageRoot(cmd)
+		if err != nil {
+			return err
+		}
+		profiles, err := stageProfiles(cmd, root)
+		if err != nil {
+			return err
+		}
+
+		configPath := stage.ConfigPath(root)
+		if _, err := config.Load(configPath, profiles...); err != nil {
+			var errs config.Errors
+			if errors.As(err, &errs) {
+				return fmt.Errorf("%w\n%d problem(s) found", errs, len(errs))
+			}
+			return err
+		}
+
+		fmt.Printf("✅ %s is valid\n", configPath)
+		return nil
+	},
+}
+
+var cmdConfigShow = &cobra.Command{
+	Use:   "show",
+	Short: "Print the stage configuration",
+	Long: `Prints .locom/locom.yml as written. With --resolved, prints the effective
+configuration instead: the active profiles merged in, ${VAR} references
+expanded from the environment and .locom/.env, and defaults filled in.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := stageRoot(cmd)
+		if err != nil {
+			return err
+		}
+		resolved, err := cmd.Flags().GetBool("resolved")
+		if err != nil {
+			return fmt.Errorf("failed to read resolved flag: %w", err)
+		}
+
+		configPath := stage.ConfigPath(root)
+		var data []byte
+		if resolved {
+			profiles, err := stageProfiles(cmd, root)
+			if err != nil {
+				return err
+			}
+			cfg, err := config.Load(configPath, profiles...)
+			if err != nil {
+				return err
+			}
+			if data, err = config.Marshal(cfg); err != nil {
+				return fmt.Errorf("serializing yaml: %w", err)
+			}
+		} else if data, err = os.ReadFile(configPath); err != nil {
+			return fmt.Errorf("reading config file: %w", err)
+		}
+
+		_, err = cmd.OutOrStdout().Write(data)
+		return err
+	},
+}
+
+var cmdConfigSchema = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of locom.yml",
+	Long: `Prints the JSON Schema (draft-07) describing locom.yml, for editor
+completion and linting, e.g. with the VS Code YAML extension:
+
+  "yaml.schemas": { "./locom.schema.json": ".locom/locom*.yml" }`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := config.Schema()
+		if err != nil {
+			return fmt.Errorf("generating schema: %w", err)
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("failed to read output flag: %w", err)
+		}
+		if output == "" {
+			_, err := cmd.OutOrStdout().Write(data)
+			return err
+		}
+		if err := os.WriteFile(output, data, 0644); err != nil {
+			return fmt.Errorf("writing schema: %w", err)
+		}
+		fmt.Printf("Wrote %s\n", output)
+		return nil
+	},
+}
+
+var cmdConfigMigrate = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade locom.yml and its profiles to the current format version",
+	Long: fmt.Sprintf(`Rewrites .locom/locom.yml and every .locom/locom.<profile>.yml to format
+version %d. The original of each upgraded file is kept as <file>.v<old>.bak.
+
+Older files keep working without migrating, as locom upgrades them in memory
+when loading; migrating makes the upgrade permanent.`, config.CurrentVersion),
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := stageRoot(cmd)
+		if err != nil {
+			return err
+		}
+
+		results, err := config.MigrateFiles(stage.ConfigPath(root))
+		for _, res := range results {
+			fmt.Printf("Migrated %s from version %d to %d (backup: %s)\n", res.Path, res.From, config.CurrentVersion, res.Backup)
+		}
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			fmt.Printf("✅ Configuration is already at version %d\n", config.CurrentVersion)
+		}
+		return nil
+	},
+}
+
+var cmdConfigGet = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the effective value of a dotted key, e.g. stage.network.bind.address",
+	Long: `Prints the value at a dotted key path of the effective configuration, after
+profiles, interpolation and defaults. List items are addressed as key[0].
+Mappings and lists are printed as YAML.`,
+	Example:      "  locom config get stage.network.dns.suffix",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := stageRoot(cmd)
+		if err != nil {
+			return err
+		}
+		profiles, err := stageProfiles(cmd, root)
+		if err != nil {
+			return err
+		}
+
+		value, err := config.Get(stage.ConfigPath(root), args[0], profiles...)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), value)
+		return nil
+	},
+}
+
+var cmdConfigSet = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a dotted key in locom.yml, keeping comments, key order and layout",
+	Long: `Sets the value at a dotted key path in .locom/locom.yml, creating missing
+parents. The value is converted to the key's type: booleans and integers are
+written unquoted, lists accept "a,b" or "[a, b]", mappings accept "{key: value}".
+Lines other than the changed ones are written back as they were, blank lines
+included. The file is only written if the result is still a valid configuration.`,
+	Example: `  locom config set stage.network.bind.address 127.0.0.2
+  locom config set apps.web.port 8080
+  locom config set apps.web.aliases www,site`,
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := stageRoot(cmd)
+		if err != nil {
+			return err
+		}
+		return config.Set(stage.ConfigPath(root), args[0], args[1])
+	},
+}
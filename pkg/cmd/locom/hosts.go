@@ -21,6 +21,7 @@ var cmdHosts = &cobra.Command{
 
 func init() {
 	cmdHosts.Flags().Bool("verify", false, "Check if the DNS name resolves and responds")
+	diffFlag(cmdHosts)
 	rootCmd.AddCommand(cmdHosts)
 }
 
@@ -29,5 +30,17 @@ func runHosts(cmd *cobra.Command) error {
 	if err != nil {
 		return fmt.Errorf("failed to read verify flag: %w", err)
 	}
-	return hosts.Setup(verify)
+	root, err := stageRoot(cmd)
+	if err != nil {
+		return err
+	}
+	profiles, err := stageProfiles(cmd, root)
+	if err != nil {
+		return err
+	}
+	w, err := fileWriter(cmd)
+	if err != nil {
+		return err
+	}
+	return hosts.Setup(w, root, profiles, verify)
 }
@@ -4,11 +4,11 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"path/filepath"
 
 	"github.com/spf13/cobra"
 
 	"github.com/localcompose/locom/internal/config"
+	"github.com/localcompose/locom/internal/stage"
 )
 
 var cmdNetwork = &cobra.Command{
@@ -18,18 +18,21 @@ var cmdNetwork = &cobra.Command{
 		"helpdisplayorder": "30",
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		configPath := filepath.Join(".locom", "locom.yml")
-		cfg, err := config.LoadConfig(configPath)
+		root, err := stageRoot(cmd)
 		if err != nil {
-			return fmt.Errorf("loading config: %w", err)
+			return err
+		}
+		profiles, err := stageProfiles(cmd, root)
+		if err != nil {
+			return err
 		}
 
-		networkName := cfg.Stage.Network.Name
-		if networkName == "" {
-			return fmt.Errorf("no network name found in config")
+		cfg, err := config.Load(stage.ConfigPath(root), profiles...)
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
 		}
 
-		return ensureDockerNetwork(networkName)
+		return ensureDockerNetwork(cfg.Stage.Network.Name)
 	},
 }
 
@@ -1,22 +1,97 @@
 package locom
 
 import (
+	"bufio"
+	"fmt"
+	"strings"
+
 	"github.com/localcompose/locom/internal/stage"
 	"github.com/spf13/cobra"
 )
 
 func init() {
+	cmdProxy.Flags().Bool("force", false, "replace an edited proxy/docker-compose.yml with the template")
+	diffFlag(cmdProxy)
+	cmdProxyPasswd.Flags().Bool("password-stdin", false, "read the password from the first line of stdin (generated and printed otherwise)")
+	cmdProxy.AddCommand(cmdProxyPasswd)
+
 	rootCmd.AddCommand(cmdProxy)
 }
 
 var cmdProxy = &cobra.Command{
 	Use:   "proxy",
-	Short: "Create a default docker-compose configuration with Traefik proxy",
+	Short: "Create a default docker-compose configuration with the stage proxy",
+	Long: `Create a default docker-compose configuration with the stage proxy, Traefik, Caddy
+or nginx as set in stage.network.proxy.type.engine.
+
+The template is rendered into .locom/proxy/docker-compose.yml and proxy/docker-compose.yml,
+along with the configuration files of the engine such as proxy/Caddyfile
+or proxy/locom.conf.
+When proxy/docker-compose.yml was edited, the template changes since it was last generated
+are merged into it; values both changed are reported as conflicts and nothing is written.
+
+With stage.network.proxy.dashboard.user set, a run that finds no password for the user in
+.locom/dashboard.htpasswd generates one, stores its hash and prints the password once;
+use locom proxy passwd to choose another.`,
 	Annotations: map[string]string{
 		"helpdisplayorder": "50",
 	},
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := stageRoot(cmd)
+		if err != nil {
+			return err
+		}
+		var opts stage.ProxyOptions
+		if opts.Force, err = cmd.Flags().GetBool("force"); err != nil {
+			return fmt.Errorf("failed to read force flag: %w", err)
+		}
+		profiles, err := stageProfiles(cmd, root)
+		if err != nil {
+			return err
+		}
+		w, err := fileWriter(cmd)
+		if err != nil {
+			return err
+		}
+		return stage.GenerateProxyComposeFiles(w, stage.ConfigPath(root), profiles, stage.ProxyDir(root), opts)
+	},
+}
+
+var cmdProxyPasswd = &cobra.Command{
+	Use:   "passwd",
+	Short: "Set the password of the dashboard user",
+	Long: `Set the basic-auth password of stage.network.proxy.dashboard.user.
+Only the apr1 hash is stored, in .locom/dashboard.htpasswd.
+Without --password-stdin a password is generated and printed once.`,
+	Example: `  locom proxy passwd
+  printf '%s\n' "$DASHBOARD_PASSWORD" | locom proxy passwd --password-stdin`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		target := "proxy"
-		return stage.GenerateProxyComposeFiles(".locom/locom.yml", target)
+		root, err := stageRoot(cmd)
+		if err != nil {
+			return err
+		}
+		profiles, err := stageProfiles(cmd, root)
+		if err != nil {
+			return err
+		}
+		fromStdin, err := cmd.Flags().GetBool("password-stdin")
+		if err != nil {
+			return fmt.Errorf("failed to read password-stdin flag: %w", err)
+		}
+		var password string
+		if fromStdin {
+			// not a flag value, which would show in ps and the shell history
+			line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+			if password = strings.TrimRight(line, "\r\n"); password == "" {
+				if err != nil {
+					return fmt.Errorf("reading the password from stdin: %w", err)
+				}
+				return fmt.Errorf("the password read from stdin is empty")
+			}
+		}
+		return stage.SetDashboardPassword(root, profiles, password)
 	},
 }
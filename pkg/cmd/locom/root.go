@@ -18,7 +18,22 @@ var main struct {
 var rootCmd = &cobra.Command{
 	Use:   "locom",
 	Short: "locom manages a local stage of Docker Compose stacks",
-	Long:  `locom is a CLI tool for managing local Docker Compose stacks in a minimal, offline-friendly way.`,
+	Long: `locom is a CLI tool for managing local Docker Compose stacks in a minimal, offline-friendly way.
+
+Commands operate on the stage found by searching the current directory and its
+parents for a .locom folder, unless --stage points at the stage root.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := cmd.Flags().GetString("chdir")
+		if err != nil {
+			return fmt.Errorf("failed to read chdir flag: %w", err)
+		}
+		if dir != "" {
+			if err := os.Chdir(dir); err != nil {
+				return fmt.Errorf("changing directory: %w", err)
+			}
+		}
+		return nil
+	},
 }
 
 func NewRootCmd() *cobra.Command {
@@ -36,6 +51,10 @@ func Execute(name, version string) {
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringP("chdir", "C", "", "Run as if locom was started in this directory")
+	rootCmd.PersistentFlags().String("stage", "", "Stage root directory (default: nearest directory with a .locom folder)")
+	rootCmd.PersistentFlags().String("profile", "", "Comma-separated profiles merged over locom.yml from locom.<profile>.yml (default: $LOCOM_PROFILE)")
+
 	// Register custom template function globally
 	cobra.AddTemplateFuncs(template.FuncMap{
 		"orderedCommands": orderedCommands,
@@ -0,0 +1,59 @@
+package locom
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/localcompose/locom/internal/config"
+	"github.com/localcompose/locom/internal/files"
+	"github.com/localcompose/locom/internal/stage"
+)
+
+// stageRoot resolves the stage the command operates on: the --stage flag when
+// given, otherwise the nearest parent of the working directory holding .locom/.
+func stageRoot(cmd *cobra.Command) (string, error) {
+	root, err := cmd.Flags().GetString("stage")
+	if err != nil {
+		return "", fmt.Errorf("failed to read stage flag: %w", err)
+	}
+	if root != "" {
+		return stage.Open(root)
+	}
+	return stage.Find(".")
+}
+
+// stageProfiles resolves the profiles merged over the locom.yml of the stage:
+// the --profile flag when given, otherwise LOCOM_PROFILE from the environment
+// or the stage's .env file.
+func stageProfiles(cmd *cobra.Command, root string) ([]string, error) {
+	if !cmd.Flags().Changed("profile") {
+		return config.EnvProfiles(stage.ConfigPath(root))
+	}
+	list, err := cmd.Flags().GetString("profile")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile flag: %w", err)
+	}
+	profiles, err := config.ParseProfiles(list)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --profile: %w", err)
+	}
+	return profiles, nil
+}
+
+// diffFlag registers --diff on a command that writes files through fileWriter.
+func diffFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("diff", false, "print the changes as unified diffs instead of writing them")
+}
+
+// fileWriter writes to disk, or previews the changes when --diff is set.
+func fileWriter(cmd *cobra.Command) (files.Writer, error) {
+	preview, err := cmd.Flags().GetBool("diff")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read diff flag: %w", err)
+	}
+	if preview {
+		return files.Preview{Out: cmd.OutOrStdout()}, nil
+	}
+	return files.Disk{}, nil
+}